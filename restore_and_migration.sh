@@ -63,10 +63,17 @@ do
 
     echo "${fileName}を適用します..."
     docker exec tuning-mysql bash -c "mysql -u root -pmysql hiroshimauniv2511-db < /etc/mysql/migration/${fileName}"
+    if [ $? -ne 0 ]; then
+        echo "${fileName}の適用に失敗しました。"
+        echo "リストアとマイグレーションに失敗しました。"
+        exit 1
+    fi
     next=$(($next + 1))
 done
 
-if [ $? -ne 0 ]; then
-    echo "リストアとマイグレーションに失敗しました。"
-    exit 1
+# 適用したマイグレーションをバックエンドのschema_migrationsに記録する (server migrate status で確認できる)
+# 記録に失敗してもスキーマには影響しないため、警告のみとする
+if [ "$next" -gt 0 ]; then
+    docker exec tuning-backend server migrate baseline $(($next - 1)) > /dev/null \
+        || echo "マイグレーションの記録に失敗しました (スキーマには適用済みです)。"
 fi
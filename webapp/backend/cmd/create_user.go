@@ -0,0 +1,82 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ユーザーを作成する (server create-user -name NAME [-role admin] [-password PASS])
+// パスワードを省略した場合は標準入力の1行目を使う (シェルの履歴に残さないため)
+func runCreateUser(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("create-user", "-name NAME [-role customer|admin] [-password PASS]")
+	name := fs.String("name", "", "user name (required)")
+	role := fs.String("role", model.RoleCustomer, "role of the user: customer or admin")
+	password := fs.String("password", "", "password; read from stdin when omitted")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *name == "" {
+		fmt.Fprintln(fs.Output(), "-name is required")
+		fs.Usage()
+		return &usageError{err: errors.New("-name is required")}
+	}
+	if *role != model.RoleCustomer && *role != model.RoleAdmin {
+		fmt.Fprintf(fs.Output(), "invalid role %q\n", *role)
+		fs.Usage()
+		return &usageError{err: fmt.Errorf("invalid role %q", *role)}
+	}
+	if *password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if *password == "" {
+		return errors.New("password must not be empty")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	c, err := openConns(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// user_nameに一意制約はないため、同じトランザクション内で重複を確認する
+	var userID int
+	err = c.store.ExecTx(ctx, func(txStore *repository.Store) error {
+		_, err := txStore.UserRepo.FindByUserName(ctx, *name)
+		if err == nil {
+			return fmt.Errorf("user %q already exists", *name)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		userID, err = txStore.UserRepo.Create(ctx, &model.User{
+			UserName:     *name,
+			PasswordHash: string(hash),
+			Role:         *role,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created user %q (user_id=%d, role=%s)\n", *name, userID, *role)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// 実行計画を表示する対象
+// リポジトリのメソッドをそのまま呼ぶため、実際に発行されるクエリの計画が表示される
+type explainTarget struct {
+	name string
+	run  func(ctx context.Context, db repository.DBTX, rdb *redis.Client) error
+}
+
+var explainTargets = []explainTarget{
+	{"login", func(ctx context.Context, db repository.DBTX, _ *redis.Client) error {
+		_, err := repository.NewUserRepository(db).FindByUserName(ctx, "user")
+		return err
+	}},
+	{"session", func(ctx context.Context, db repository.DBTX, _ *redis.Client) error {
+		_, err := repository.NewSessionRepository(db).FindUserBySessionID(ctx, "00000000-0000-0000-0000-000000000000")
+		return err
+	}},
+	{"products", func(ctx context.Context, db repository.DBTX, rdb *redis.Client) error {
+		_, _, err := repository.NewProductRepository(db, rdb).ListProducts(ctx, 1, model.ListRequest{PageSize: 20, SortField: "value", SortOrder: "desc"})
+		return err
+	}},
+	{"products-search", func(ctx context.Context, db repository.DBTX, rdb *redis.Client) error {
+		_, _, err := repository.NewProductRepository(db, rdb).ListProducts(ctx, 1, model.ListRequest{Search: "商品", PageSize: 20})
+		return err
+	}},
+	{"orders", func(ctx context.Context, db repository.DBTX, _ *redis.Client) error {
+		_, _, err := repository.NewOrderRepository(db).ListOrders(ctx, 1, model.ListRequest{PageSize: 20, SortField: "created_at", SortOrder: "desc"})
+		return err
+	}},
+	{"orders-search", func(ctx context.Context, db repository.DBTX, _ *redis.Client) error {
+		_, _, err := repository.NewOrderRepository(db).ListOrders(ctx, 1, model.ListRequest{Search: "商品", Type: "prefix", PageSize: 20})
+		return err
+	}},
+	{"orders-export", func(ctx context.Context, db repository.DBTX, _ *redis.Client) error {
+		return repository.NewOrderRepository(db).EachOrder(ctx, 1, model.ListRequest{SortField: "created_at", SortOrder: "desc"},
+			func(model.Order) error { return nil })
+	}},
+	{"shipping-orders", func(ctx context.Context, db repository.DBTX, _ *redis.Client) error {
+		_, err := repository.NewOrderRepository(db).GetShippingOrders(ctx)
+		return err
+	}},
+}
+
+// 主要なクエリの実行計画を表示する (server explain-plan [-analyze] [target...])
+func runExplainPlan(ctx context.Context, cfg *config.Config, args []string) error {
+	names := make([]string, 0, len(explainTargets))
+	for _, t := range explainTargets {
+		names = append(names, t.name)
+	}
+	fs := newFlagSet("explain-plan", "[-analyze] [target...]\n\ntargets: "+strings.Join(names, ", "))
+	analyze := fs.Bool("analyze", false, "run the queries with EXPLAIN ANALYZE to show actual row counts and timings")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{err: err}
+	}
+	for _, name := range fs.Args() {
+		if !slices.Contains(names, name) {
+			fmt.Fprintf(fs.Output(), "unknown target %q\n", name)
+			fs.Usage()
+			return &usageError{err: fmt.Errorf("unknown target %q", name)}
+		}
+	}
+
+	c, err := openConns(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	prefix := "EXPLAIN FORMAT=TREE "
+	if *analyze {
+		prefix = "EXPLAIN ANALYZE "
+	}
+	for _, t := range explainTargets {
+		if fs.NArg() > 0 && !slices.Contains(fs.Args(), t.name) {
+			continue
+		}
+		fmt.Printf("== %s\n", t.name)
+		if err := t.run(ctx, &explainDB{db: c.db, prefix: prefix}, c.rdb); err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// SELECTを実行する代わりに実行計画を表示するDBTX
+// 結果は返さないため、リポジトリは0件として処理を続ける
+type explainDB struct {
+	db     *sqlx.DB
+	prefix string
+}
+
+func (e *explainDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return e.explain(ctx, query, args)
+}
+
+func (e *explainDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return e.explain(ctx, query, args)
+}
+
+// 実行計画を表示し、0件の結果を返す
+func (e *explainDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	if err := e.explain(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return e.db.QueryxContext(ctx, "SELECT 1 FROM DUAL WHERE FALSE")
+}
+
+func (e *explainDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, fmt.Errorf("explain-plan does not run write queries: %s", strings.TrimSpace(query))
+}
+
+func (e *explainDB) Rebind(query string) string {
+	return e.db.Rebind(query)
+}
+
+func (e *explainDB) explain(ctx context.Context, query string, args []interface{}) error {
+	var plan string
+	if err := e.db.GetContext(ctx, &plan, e.prefix+query, args...); err != nil {
+		return fmt.Errorf("failed to explain query: %w", err)
+	}
+	fmt.Printf("%s\n\n%s\n\n", compactSQL(query), plan)
+	return nil
+}
+
+// 表示用に空白と改行を詰める
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
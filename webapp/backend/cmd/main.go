@@ -1,30 +1,131 @@
 package main
 
 import (
-	"backend/internal/server"
-	"backend/internal/telemetry"
+	"backend/internal/config"
+	"backend/internal/logging"
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 )
 
+// サブコマンド
+// 引数を省略した場合はserveとして動く (コンテナのENTRYPOINTは引数なしで起動する)
+type command struct {
+	summary string
+	run     func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":        {"start the API server (default)", runServe},
+	"migrate":      {"apply, revert or inspect schema migrations", runMigrate},
+	"seed":         {"insert sample users, products and orders", runSeed},
+	"create-user":  {"create a user with a bcrypt-hashed password", runCreateUser},
+	"reset-orders": {"move delivering orders back to shipping", runResetOrders},
+	"explain-plan": {"show MySQL execution plans of the main queries", runExplainPlan},
+}
+
+// 引数の誤り。使い方は表示済みなので、mainは終了コード2で終了するだけにする
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+
+// フラグを解析する。-hの場合はflag.ErrHelpをそのまま返す
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{err: err}
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return &usageError{err: fmt.Errorf("unexpected argument %q", fs.Arg(0))}
+	}
+	return nil
+}
+
+// 使い方を表示するFlagSetを作る
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: server %s %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: server [command] [args]\n\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s%s\n", name, commands[name].summary)
+	}
+}
+
 func main() {
-	shutdown, err := telemetry.Init(context.Background())
-	if err != nil {
-		log.Printf("telemetry init failed: %v, continuing without telemetry", err)
-	} else {
-		defer func() { _ = shutdown(context.Background()) }()
+	// deferを実行してから終了コードを返すため、os.Exitはここでのみ呼ぶ
+	exitCode := 0
+	defer func() { os.Exit(exitCode) }()
+
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage()
+		exitCode = 2
+		return
 	}
 
-	srv, dbConn, rdbClient, err := server.NewServer()
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to initialize server: %v", err)
+		slog.Error("invalid configuration", "error", err)
+		exitCode = 1
+		return
 	}
-	if dbConn != nil {
-		defer dbConn.Close()
+	// serve以外のコマンドは標準出力に結果を出すため、ログは標準エラー出力に出す
+	logOut := os.Stdout
+	if name != "serve" {
+		logOut = os.Stderr
 	}
+	logger, err := logging.New(logOut, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		slog.Error("failed to set up logger", "error", err)
+		exitCode = 1
+		return
+	}
+	slog.SetDefault(logger)
+
+	// SIGTERM/SIGINTでサーバーはグレースフルシャットダウンを、他のコマンドは処理の中断を行う
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	if rdbClient != nil {
-		defer rdbClient.Close()
+	var ue *usageError
+	switch err := cmd.run(ctx, cfg, args); {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.As(err, &ue):
+		exitCode = 2
+	default:
+		slog.Error("command failed", "command", name, "error", err)
+		exitCode = 1
 	}
-	srv.Run()
 }
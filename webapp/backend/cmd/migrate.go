@@ -0,0 +1,115 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/migrate"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up              apply all pending migrations
+  down [N]        revert the last N applied migrations (default 1)
+  status          show applied and pending migrations
+  baseline N      record migrations up to N as applied without running them`
+
+// マイグレーションのサブコマンド (server migrate up|down|status|baseline)
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return migrateUsageError("missing command")
+	}
+	if !slices.Contains([]string{"up", "down", "status", "baseline"}, args[0]) {
+		return migrateUsageError(fmt.Sprintf("unknown command %q", args[0]))
+	}
+
+	dbConn, err := db.InitDBConnection(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+	m, err := migrate.New(dbConn)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up(ctx)
+		printMigrations("applied", done)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return migrateUsageError(fmt.Sprintf("invalid number of steps %q", args[1]))
+			}
+		}
+		done, err := m.Down(ctx, steps)
+		printMigrations("reverted", done)
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+	case "baseline":
+		if len(args) < 2 {
+			return migrateUsageError("missing version")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return migrateUsageError(fmt.Sprintf("invalid version %q", args[1]))
+		}
+		done, err := m.Baseline(ctx, version)
+		printMigrations("recorded", done)
+		return err
+	}
+	return nil
+}
+
+func migrateUsageError(msg string) error {
+	fmt.Fprintf(os.Stderr, "%s\n%s\n", msg, migrateUsage)
+	return &usageError{err: errors.New(msg)}
+}
+
+func printMigrations(verb string, migrations []migrate.Migration) {
+	if len(migrations) == 0 {
+		fmt.Printf("no migrations %s\n", verb)
+		return
+	}
+	for _, m := range migrations {
+		fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+func printStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		switch {
+		case s.Dirty:
+			state = "dirty"
+		case s.Modified && s.Up == "":
+			state = "missing"
+		case s.Modified:
+			state = "modified"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	w.Flush()
+}
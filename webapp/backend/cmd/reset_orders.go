@@ -0,0 +1,28 @@
+package main
+
+import (
+	"backend/internal/config"
+	"context"
+	"fmt"
+)
+
+// 配送中(delivering)の注文を配送待ち(shipping)に戻す
+// ロボットが配送を完了できずに止まった場合に、再び配送計画の対象にするために使う
+func runResetOrders(ctx context.Context, cfg *config.Config, args []string) error {
+	if err := parseFlags(newFlagSet("reset-orders", ""), args); err != nil {
+		return err
+	}
+
+	c, err := openConns(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	n, err := c.store.OrderRepo.ResetStatuses(ctx, "delivering", "shipping")
+	if err != nil {
+		return fmt.Errorf("failed to reset orders: %w", err)
+	}
+	fmt.Printf("moved %d orders from delivering to shipping\n", n)
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/datagen"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// テストデータを生成し、MySQLに投入するかファイルに書き出す
+// 同じ引数なら常に同じ内容になる (server seed [flags])
+func runSeed(ctx context.Context, cfg *config.Config, args []string) error {
+	gen := datagen.DefaultConfig()
+	fs := newFlagSet("seed", "[-format mysql|sql|csv|requests] [-out PATH] [flags]")
+	fs.Int64Var(&gen.Seed, "seed", gen.Seed, "random seed")
+	fs.IntVar(&gen.Users, "users", gen.Users, "number of customers")
+	fs.IntVar(&gen.Products, "products", gen.Products, "number of products")
+	fs.IntVar(&gen.Orders, "orders", gen.Orders, "number of orders (or order requests with -format requests)")
+	fs.StringVar(&gen.Password, "password", gen.Password, "password shared by all generated customers")
+	fs.IntVar(&gen.BcryptCost, "bcrypt-cost", gen.BcryptCost, "bcrypt cost of the password hashes")
+	statusMix := fs.String("status-mix", datagen.FormatStatusMix(gen.StatusMix), "relative weights of order statuses")
+	until := fs.String("until", gen.Until.Format(time.RFC3339), "latest order creation time (RFC 3339)")
+	fs.DurationVar(&gen.Span, "span", gen.Span, "orders are created within this duration before -until")
+	format := fs.String("format", "mysql", "mysql inserts into the database; sql, csv and requests write fixtures")
+	out := fs.String("out", "-", "output file for sql/requests (- for stdout) or directory for csv")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var err error
+	if gen.StatusMix, err = datagen.ParseStatusMix(*statusMix); err != nil {
+		return seedUsageError(fs, err)
+	}
+	if gen.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+		return seedUsageError(fs, fmt.Errorf("invalid -until: %w", err))
+	}
+
+	switch *format {
+	case "requests":
+		reqs, err := datagen.GenerateOrderRequests(gen.Seed, gen.Orders, gen.Products)
+		if err != nil {
+			return seedUsageError(fs, err)
+		}
+		return writeOutput(*out, func(w io.Writer) error { return datagen.WriteOrderRequests(w, reqs) })
+	case "mysql", "sql", "csv":
+	default:
+		return seedUsageError(fs, fmt.Errorf("unknown format %q", *format))
+	}
+	if *format == "csv" && *out == "-" {
+		return seedUsageError(fs, errors.New("-format csv requires -out DIR"))
+	}
+
+	start := time.Now()
+	ds, err := datagen.Generate(gen)
+	if err != nil {
+		return seedUsageError(fs, err)
+	}
+	slog.Info("generated dataset", "users", len(ds.Users), "products", len(ds.Products), "orders", len(ds.Orders), "elapsed", time.Since(start))
+
+	switch *format {
+	case "sql":
+		return writeOutput(*out, func(w io.Writer) error { return datagen.WriteSQL(w, ds) })
+	case "csv":
+		return datagen.WriteCSV(*out, ds)
+	}
+
+	c, err := openConns(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := importDataset(ctx, c.store, ds); err != nil {
+		return err
+	}
+	fmt.Printf("inserted %d users, %d products and %d orders\n", len(ds.Users), len(ds.Products), len(ds.Orders))
+	return nil
+}
+
+func seedUsageError(fs *flag.FlagSet, err error) error {
+	fmt.Fprintln(os.Stderr, err)
+	fs.Usage()
+	return &usageError{err: err}
+}
+
+// pathが-なら標準出力に、それ以外はファイルに書き出す
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// 生成したデータを1つのトランザクションで投入する
+// 既存のデータがあってもよいよう、IDは採番に任せて注文の参照先を付け替える
+func importDataset(ctx context.Context, store *repository.Store, ds *datagen.Dataset) error {
+	return store.ExecTx(ctx, func(txStore *repository.Store) error {
+		userIDs := make(map[int]int, len(ds.Users))
+		for _, u := range ds.Users {
+			id, err := txStore.UserRepo.Create(ctx, &u)
+			if err != nil {
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+			userIDs[u.UserID] = id
+		}
+
+		productIDs := make(map[int]int, len(ds.Products))
+		for _, p := range ds.Products {
+			id, err := txStore.ProductRepo.Create(ctx, model.ProductInput{
+				Name:        p.Name,
+				Value:       p.Value,
+				Weight:      p.Weight,
+				Image:       p.Image,
+				Description: p.Description,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create product: %w", err)
+			}
+			productIDs[p.ProductID] = id
+		}
+
+		orders := make([]model.Order, len(ds.Orders))
+		for i, o := range ds.Orders {
+			o.UserID = userIDs[o.UserID]
+			o.ProductID = productIDs[o.ProductID]
+			orders[i] = o
+		}
+		return txStore.OrderRepo.Import(ctx, orders)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/logging"
+	"backend/internal/server"
+	"backend/internal/telemetry"
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// APIサーバーを起動し、ctxがキャンセルされるまで動かす
+func runServe(ctx context.Context, cfg *config.Config, args []string) error {
+	if err := parseFlags(newFlagSet("serve", ""), args); err != nil {
+		return err
+	}
+
+	// 秘密情報はRedactedで伏せてから出力する
+	slog.Info("effective config", "config", cfg.Redacted())
+
+	tel, err := telemetry.Init(context.Background(), cfg.Telemetry)
+	if err != nil {
+		slog.Warn("telemetry init failed, continuing without telemetry", "error", err)
+	} else {
+		defer func() {
+			if err := tel.Shutdown(context.Background()); err != nil {
+				slog.Warn("failed to shut down telemetry", "error", err)
+			}
+		}()
+		if tel.LogHandler != nil {
+			// ログもOpenTelemetryに送るよう、出力先を追加して作り直す
+			if _, err := logging.Setup(cfg.Log.Level, cfg.Log.Format, tel.LogHandler); err != nil {
+				slog.Warn("failed to attach telemetry log handler", "error", err)
+			}
+		}
+	}
+
+	srv, err := server.NewServer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize server: %w", err)
+	}
+	if err := srv.Run(ctx); err != nil {
+		return fmt.Errorf("server stopped with error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/repository"
+	"context"
+	"log/slog"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// 運用コマンドで使う接続
+type conns struct {
+	db    *sqlx.DB
+	rdb   *redis.Client
+	store *repository.Store
+}
+
+// サーバーと同じ設定でMySQLとRedisに接続し、Storeを作る
+// Redisは商品総数キャッシュの破棄にしか使わないため、接続できなくても続行する
+func openConns(ctx context.Context, cfg *config.Config) (*conns, error) {
+	dbConn, err := db.InitDBConnection(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		slog.Warn("failed to connect to redis, product total cache will not be invalidated", "addr", cfg.Redis.Addr, "error", err)
+	}
+	return &conns{db: dbConn, rdb: rdb, store: repository.NewStore(dbConn, rdb)}, nil
+}
+
+func (c *conns) Close() {
+	c.rdb.Close()
+	c.db.Close()
+}
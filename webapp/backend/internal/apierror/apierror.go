@@ -0,0 +1,159 @@
+// エラーレスポンスを {code, message, details, request_id} 形式のJSONで返す
+// ハンドラーとミドルウェアの両方から使うため、どちらにも依存しない
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"backend/internal/logging"
+	"backend/internal/service"
+	"backend/internal/service/utils"
+)
+
+// リクエストIDはRequestIDMiddlewareがレスポンスヘッダーに設定したものを使う
+const requestIDHeader = "X-Request-ID"
+
+// よく使うコード
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "request_too_large"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeTimeout          = "timeout"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal_error"
+)
+
+type Response struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+	// タイムアウトの場合、期限切れになった処理の段階
+	Stage     string `json:"stage,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// 検証エラーの詳細
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// 指定したステータス・コード・メッセージでエラーレスポンスを返す
+func Write(w http.ResponseWriter, status int, code, message string, details any) {
+	writeResponse(w, status, Response{Code: code, Message: message, Details: details})
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp Response) {
+	h := w.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	// ServeContent等が設定したヘッダーがエラー本文に付かないようにする
+	h.Del("Content-Length")
+	h.Del("ETag")
+	h.Del("Cache-Control")
+	w.WriteHeader(status)
+	resp.RequestID = h.Get(requestIDHeader)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// サービス層のエラーを種類に応じたステータスで返す
+// 5xxの場合は内部のエラー内容をログに出し、クライアントには汎用的なメッセージのみ返す
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	kind := service.KindOf(err)
+	status := StatusOf(kind)
+
+	code, message := CodeInternal, "internal server error"
+	var details any
+	var stage string
+	var svcErr *service.Error
+	var validationErr *service.ValidationError
+	var tooMany *service.TooManyAttemptsError
+	switch {
+	case errors.As(err, &validationErr):
+		code, message = CodeValidationFailed, validationErr.Error()
+		details = []FieldError{{Field: validationErr.Field, Message: validationErr.Message}}
+	case errors.As(err, &tooMany):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+		code, message = CodeTooManyRequests, "too many requests"
+	case errors.As(err, &svcErr) && status < http.StatusInternalServerError:
+		code, message = svcErr.Code, svcErr.Message
+	case kind == service.KindTimeout:
+		code, message = CodeTimeout, "request timed out"
+		var timeoutErr *utils.TimeoutError
+		if errors.As(err, &timeoutErr) {
+			stage = timeoutErr.Stage
+		}
+	case kind == service.KindUnavailable:
+		code, message = CodeUnavailable, "service unavailable"
+	}
+
+	if status >= http.StatusInternalServerError {
+		logging.Error(r.Context(), "request failed",
+			"method", r.Method, "path", r.URL.Path, "status", status, "error", err)
+	}
+	writeResponse(w, status, Response{Code: code, Message: message, Details: details, Stage: stage})
+}
+
+// エラーの種類に対応するHTTPステータス
+func StatusOf(kind service.ErrorKind) int {
+	switch kind {
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindValidation:
+		return http.StatusBadRequest
+	case service.KindUnauthorized:
+		return http.StatusUnauthorized
+	case service.KindForbidden:
+		return http.StatusForbidden
+	case service.KindTooManyRequests:
+		return http.StatusTooManyRequests
+	case service.KindTimeout:
+		return http.StatusGatewayTimeout
+	case service.KindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// リクエストボディが不正な場合
+func InvalidRequest(w http.ResponseWriter, message string) {
+	Write(w, http.StatusBadRequest, CodeInvalidRequest, message, nil)
+}
+
+// リクエストボディを読み込めなかった場合 (上限超過は413、それ以外は400)
+func InvalidBody(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		TooLarge(w, maxBytesErr.Limit)
+		return
+	}
+	InvalidRequest(w, "invalid request body")
+}
+
+// リクエストボディが上限を超えた場合
+func TooLarge(w http.ResponseWriter, limit int64) {
+	Write(w, http.StatusRequestEntityTooLarge, CodeTooLarge,
+		fmt.Sprintf("request body must not exceed %d bytes", limit), nil)
+}
+
+// ルートが見つからない場合 (chiのNotFoundに設定する)
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, http.StatusNotFound, CodeNotFound, "not found", nil)
+}
+
+// メソッドが許可されていない場合 (chiのMethodNotAllowedに設定する)
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed", nil)
+}
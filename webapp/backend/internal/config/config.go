@@ -0,0 +1,687 @@
+// アプリケーションの設定を一箇所で読み込み・検証する
+// 優先順位: 環境変数 > 設定ファイル(CONFIG_FILE, YAML/TOML) > デフォルト値
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "***"
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server"    toml:"server"    json:"server"`
+	Database  DatabaseConfig  `yaml:"database"  toml:"database"  json:"database"`
+	Redis     RedisConfig     `yaml:"redis"     toml:"redis"     json:"redis"`
+	Auth      AuthConfig      `yaml:"auth"      toml:"auth"      json:"auth"`
+	Image     ImageConfig     `yaml:"image"     toml:"image"     json:"image"`
+	Log       LogConfig       `yaml:"log"       toml:"log"       json:"log"`
+	Telemetry TelemetryConfig `yaml:"telemetry" toml:"telemetry" json:"telemetry"`
+	OpenAPI   OpenAPIConfig   `yaml:"openapi"   toml:"openapi"   json:"openapi"`
+	Outbox    OutboxConfig    `yaml:"outbox"    toml:"outbox"    json:"outbox"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks"  toml:"webhooks"  json:"webhooks"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port" toml:"port" json:"port"`
+	// リクエストに適用するデフォルトのタイムアウト
+	RequestTimeout Duration `yaml:"request_timeout" toml:"request_timeout" json:"request_timeout"`
+	// ルート("GET /api/robot/delivery-plan"のようなメソッドとchiのパターン)または
+	// 処理の段階("delivery_plan.solve"のようなutils.RunStageの名前)ごとのタイムアウト
+	// ルートに0を指定するとタイムアウトしない
+	Timeouts map[string]Duration `yaml:"timeouts" toml:"timeouts" json:"timeouts"`
+	// シャットダウン時、readinessを落としてから新規リクエストの受付を止めるまでの待ち時間
+	ShutdownDrainDelay Duration `yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay" json:"shutdown_drain_delay"`
+	// 処理中のリクエストの完了を待つ最大時間
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" json:"shutdown_timeout"`
+	// JSON APIのリクエストボディの上限 (バイト)。商品画像のアップロードには別の上限を適用する
+	MaxBodyBytes int `yaml:"max_body_bytes" toml:"max_body_bytes" json:"max_body_bytes"`
+}
+
+type DatabaseConfig struct {
+	// user:password@tcp(host:port)/dbname 形式
+	URL             string   `yaml:"url"               toml:"url"               json:"url"`
+	MaxOpenConns    int      `yaml:"max_open_conns"    toml:"max_open_conns"    json:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns"    toml:"max_idle_conns"    json:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" json:"conn_max_lifetime"`
+	// 未適用のマイグレーションがある場合に起動しない (falseの場合は警告のみ)
+	RequireMigrations bool `yaml:"require_migrations" toml:"require_migrations" json:"require_migrations"`
+	// 読み取り専用のレプリカ (空の場合はすべてプライマリで処理する)
+	ReplicaURL string `yaml:"replica_url" toml:"replica_url" json:"replica_url"`
+	// レプリカの遅延がこれを超えた場合はプライマリから読む
+	ReplicaMaxLag Duration `yaml:"replica_max_lag" toml:"replica_max_lag" json:"replica_max_lag"`
+	// レプリカの遅延を確認する間隔
+	ReplicaCheckInterval Duration `yaml:"replica_check_interval" toml:"replica_check_interval" json:"replica_check_interval"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"     toml:"addr"     json:"addr"`
+	Password string `yaml:"password" toml:"password" json:"password"`
+	DB       int    `yaml:"db"       toml:"db"       json:"db"`
+}
+
+type AuthConfig struct {
+	RobotAPIKey string       `yaml:"robot_api_key" toml:"robot_api_key" json:"robot_api_key"`
+	CSRFEnabled bool         `yaml:"csrf_enabled"  toml:"csrf_enabled"  json:"csrf_enabled"`
+	Cookie      CookieConfig `yaml:"cookie"        toml:"cookie"        json:"cookie"`
+	// X-Real-IP / X-Forwarded-Forを信頼するプロキシ (IPアドレスまたはCIDR)
+	// それ以外からの接続は、ヘッダーを無視して接続元のアドレスを使う
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" json:"trusted_proxies"`
+}
+
+type CookieConfig struct {
+	// auto / true / false
+	Secure string `yaml:"secure" toml:"secure" json:"secure"`
+	// lax / strict / none
+	SameSite string `yaml:"samesite" toml:"samesite" json:"samesite"`
+	Domain   string `yaml:"domain"   toml:"domain"   json:"domain"`
+}
+
+type ImageConfig struct {
+	// fs / s3
+	Store string   `yaml:"store" toml:"store" json:"store"`
+	Dir   string   `yaml:"dir"   toml:"dir"   json:"dir"`
+	S3    S3Config `yaml:"s3"    toml:"s3"    json:"s3"`
+}
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"   toml:"endpoint"   json:"endpoint"`
+	Bucket    string `yaml:"bucket"     toml:"bucket"     json:"bucket"`
+	AccessKey string `yaml:"access_key" toml:"access_key" json:"access_key"`
+	SecretKey string `yaml:"secret_key" toml:"secret_key" json:"secret_key"`
+	Region    string `yaml:"region"     toml:"region"     json:"region"`
+	UseSSL    bool   `yaml:"use_ssl"    toml:"use_ssl"    json:"use_ssl"`
+	Prefix    string `yaml:"prefix"     toml:"prefix"     json:"prefix"`
+}
+
+type LogConfig struct {
+	// debug / info / warn / error
+	Level string `yaml:"level"  toml:"level"  json:"level"`
+	// json / text
+	Format string `yaml:"format" toml:"format" json:"format"`
+}
+
+type TelemetryConfig struct {
+	// falseの場合はトレース・メトリクス・ログのいずれもエクスポートしない
+	Enabled bool `yaml:"enabled"  toml:"enabled"  json:"enabled"`
+	// otlp / stdout / file
+	Exporter string `yaml:"exporter" toml:"exporter" json:"exporter"`
+	// exporter=otlpの場合のプロトコル (grpc / http)
+	Protocol string `yaml:"protocol" toml:"protocol" json:"protocol"`
+	// host:port または URL (例: jaeger:4317, http://collector:4318)
+	Endpoint string `yaml:"endpoint" toml:"endpoint" json:"endpoint"`
+	Insecure bool   `yaml:"insecure" toml:"insecure" json:"insecure"`
+	// exporter=fileの場合の出力先 (トレース・メトリクス・ログをJSON Linesで追記する)
+	FilePath    string  `yaml:"file_path"    toml:"file_path"    json:"file_path"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" json:"sample_ratio"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" json:"service_name"`
+	Environment string  `yaml:"environment"  toml:"environment"  json:"environment"`
+	// メトリクス・ログもOTLP等でエクスポートする (Jaegerはトレースのみ受け付けるためデフォルトは無効)
+	Metrics bool `yaml:"metrics" toml:"metrics" json:"metrics"`
+	Logs    bool `yaml:"logs"    toml:"logs"    json:"logs"`
+}
+
+type OpenAPIConfig struct {
+	// OpenAPI定義でリクエストを検証する
+	ValidateRequests bool `yaml:"validate_requests"  toml:"validate_requests"  json:"validate_requests"`
+	// レスポンスの検証 (off / log / strict)
+	ValidateResponses string `yaml:"validate_responses" toml:"validate_responses" json:"validate_responses"`
+}
+
+type OutboxConfig struct {
+	// 注文のドメインイベントの配信先 (log / redis / webhook / none、デフォルトはnone)
+	// noneの場合、Webhookが無効ならリレーを動かさず、イベントもoutbox_eventsに記録しない
+	Sink string `yaml:"sink" toml:"sink" json:"sink"`
+	// 未配信のイベントを確認する間隔
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval" json:"poll_interval"`
+	BatchSize    int      `yaml:"batch_size"    toml:"batch_size"    json:"batch_size"`
+	// 配信済みのイベントを残す期間 (0の場合は削除しない)
+	Retention Duration `yaml:"retention" toml:"retention" json:"retention"`
+	// この回数配信に失敗したイベントは配信を諦める (last_errorを残して再送しない)
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts" json:"max_attempts"`
+	// 再送の間隔の上限 (失敗するたびにpoll_intervalから倍にする)
+	BackoffMax Duration `yaml:"backoff_max" toml:"backoff_max" json:"backoff_max"`
+	// sink=redisの場合の追加先のStreamと、その最大長
+	RedisStream string `yaml:"redis_stream"  toml:"redis_stream"  json:"redis_stream"`
+	RedisMaxLen int    `yaml:"redis_max_len" toml:"redis_max_len" json:"redis_max_len"`
+	// sink=webhookの場合の送信先
+	WebhookURL     string   `yaml:"webhook_url"     toml:"webhook_url"     json:"webhook_url"`
+	WebhookTimeout Duration `yaml:"webhook_timeout" toml:"webhook_timeout" json:"webhook_timeout"`
+}
+
+// 管理APIで登録したWebhookへの送信 (イベントはoutboxのリレーが予約する)
+type WebhooksConfig struct {
+	// デフォルトは無効 (有効にすると、未配信のイベントを予約するためoutboxのリレーも動かす)
+	Enabled bool `yaml:"enabled" toml:"enabled" json:"enabled"`
+	// 送信時刻になった配信を確認する間隔と、1回に並行で送信する数
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval" json:"poll_interval"`
+	BatchSize    int      `yaml:"batch_size"    toml:"batch_size"    json:"batch_size"`
+	// この回数失敗した配信は再送待ちに移す
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts" json:"max_attempts"`
+	// 再送の間隔 (失敗するたびに倍にし、backoff_maxを上限とする)
+	BackoffBase Duration `yaml:"backoff_base" toml:"backoff_base" json:"backoff_base"`
+	BackoffMax  Duration `yaml:"backoff_max"  toml:"backoff_max"  json:"backoff_max"`
+	// 1回の送信のタイムアウト
+	Timeout Duration `yaml:"timeout" toml:"timeout" json:"timeout"`
+	// プライベートアドレス・ループバック・リンクローカルへの登録と送信を許可する (ローカルでの動作確認用)
+	AllowPrivateTargets bool `yaml:"allow_private_targets" toml:"allow_private_targets" json:"allow_private_targets"`
+}
+
+// デフォルトのロボットAPIキー (本番では必ず上書きすること)
+const DefaultRobotAPIKey = "test-robot-key"
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:               "8080",
+			RequestTimeout:     Duration(2 * time.Second),
+			ShutdownDrainDelay: Duration(5 * time.Second),
+			ShutdownTimeout:    Duration(20 * time.Second),
+			MaxBodyBytes:       1 << 20,
+			// 画像の変換はJSON APIより時間がかかるため長めにする
+			// SSEの配信はクライアントが切断するまで続くため、タイムアウトしない
+			Timeouts: map[string]Duration{
+				"GET /api/v1/image":                          Duration(10 * time.Second),
+				"POST /api/admin/products/{productID}/image": Duration(30 * time.Second),
+				"GET /api/v1/orders/stream":                  0,
+				"GET /api/v1/orders/export":                  0,
+			},
+		},
+		Database: DatabaseConfig{
+			URL:                  "user:password@tcp(db:4306)/hiroshimauniv2511-db",
+			MaxOpenConns:         25,
+			MaxIdleConns:         10,
+			ReplicaMaxLag:        Duration(2 * time.Second),
+			ReplicaCheckInterval: Duration(time.Second),
+		},
+		Redis: RedisConfig{
+			Addr: "redis:6379", // docker-compose.ymlで定義したサービス名
+		},
+		Auth: AuthConfig{
+			RobotAPIKey: DefaultRobotAPIKey,
+			CSRFEnabled: true,
+			// nginxからはdockerのネットワーク(プライベートアドレス)経由で接続する
+			TrustedProxies: []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+		},
+		Image: ImageConfig{
+			Store: "fs",
+			Dir:   "/app/images",
+			S3:    S3Config{UseSSL: true},
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Telemetry: TelemetryConfig{
+			Exporter:    "otlp",
+			Protocol:    "grpc",
+			Endpoint:    "jaeger:4317",
+			Insecure:    true,
+			FilePath:    "telemetry.jsonl",
+			SampleRatio: 0.01,
+			ServiceName: "backend",
+			Environment: "local",
+		},
+		OpenAPI: OpenAPIConfig{
+			ValidateRequests:  true,
+			ValidateResponses: "off",
+		},
+		Outbox: OutboxConfig{
+			Sink:           "none",
+			PollInterval:   Duration(time.Second),
+			BatchSize:      100,
+			Retention:      Duration(7 * 24 * time.Hour),
+			MaxAttempts:    10,
+			BackoffMax:     Duration(10 * time.Minute),
+			RedisStream:    "outbox:orders",
+			RedisMaxLen:    100000,
+			WebhookTimeout: Duration(5 * time.Second),
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:      false,
+			PollInterval: Duration(time.Second),
+			BatchSize:    20,
+			MaxAttempts:  8,
+			BackoffBase:  Duration(10 * time.Second),
+			BackoffMax:   Duration(time.Hour),
+			Timeout:      Duration(5 * time.Second),
+		},
+	}
+}
+
+// デフォルト値・設定ファイル・環境変数の順に読み込み、検証する
+func Load() (*Config, error) {
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	integer := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+	float := func(key string, dst *float64) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	duration := func(key string, dst *Duration) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = Duration(d)
+		}
+	}
+
+	str("PORT", &cfg.Server.Port)
+	duration("REQUEST_TIMEOUT", &cfg.Server.RequestTimeout)
+	// TIMEOUTS="GET /api/robot/delivery-plan=5s,delivery_plan.solve=3s"
+	if v, ok := os.LookupEnv("TIMEOUTS"); ok && v != "" {
+		timeouts, err := parseTimeouts(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TIMEOUTS: %w", err))
+		} else {
+			// 既定値や設定ファイルの値に上書き・追加する
+			if cfg.Server.Timeouts == nil {
+				cfg.Server.Timeouts = make(map[string]Duration)
+			}
+			maps.Copy(cfg.Server.Timeouts, timeouts)
+		}
+	}
+	duration("SHUTDOWN_DRAIN_DELAY", &cfg.Server.ShutdownDrainDelay)
+	duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	integer("MAX_BODY_BYTES", &cfg.Server.MaxBodyBytes)
+
+	str("DATABASE_URL", &cfg.Database.URL)
+	integer("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	integer("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+	boolean("DB_REQUIRE_MIGRATIONS", &cfg.Database.RequireMigrations)
+	str("DB_REPLICA_URL", &cfg.Database.ReplicaURL)
+	duration("DB_REPLICA_MAX_LAG", &cfg.Database.ReplicaMaxLag)
+	duration("DB_REPLICA_CHECK_INTERVAL", &cfg.Database.ReplicaCheckInterval)
+
+	str("REDIS_ADDR", &cfg.Redis.Addr)
+	str("REDIS_PASSWORD", &cfg.Redis.Password)
+	integer("REDIS_DB", &cfg.Redis.DB)
+
+	str("ROBOT_API_KEY", &cfg.Auth.RobotAPIKey)
+	boolean("CSRF_ENABLED", &cfg.Auth.CSRFEnabled)
+	str("COOKIE_SECURE", &cfg.Auth.Cookie.Secure)
+	str("COOKIE_SAMESITE", &cfg.Auth.Cookie.SameSite)
+	str("COOKIE_DOMAIN", &cfg.Auth.Cookie.Domain)
+	// TRUSTED_PROXIES="10.0.0.0/8,192.168.1.10"
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok && v != "" {
+		cfg.Auth.TrustedProxies = nil
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				cfg.Auth.TrustedProxies = append(cfg.Auth.TrustedProxies, part)
+			}
+		}
+	}
+
+	str("IMAGE_STORE", &cfg.Image.Store)
+	str("IMAGE_DIR", &cfg.Image.Dir)
+	str("S3_ENDPOINT", &cfg.Image.S3.Endpoint)
+	str("S3_BUCKET", &cfg.Image.S3.Bucket)
+	str("S3_ACCESS_KEY", &cfg.Image.S3.AccessKey)
+	str("S3_SECRET_KEY", &cfg.Image.S3.SecretKey)
+	str("S3_REGION", &cfg.Image.S3.Region)
+	boolean("S3_USE_SSL", &cfg.Image.S3.UseSSL)
+	str("S3_PREFIX", &cfg.Image.S3.Prefix)
+
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+
+	// TRACE_ENABLEDが未指定でもエンドポイントが指定されていれば有効にする
+	if os.Getenv("TRACE_ENABLED") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		cfg.Telemetry.Enabled = true
+	}
+	boolean("TRACE_ENABLED", &cfg.Telemetry.Enabled)
+	str("TELEMETRY_EXPORTER", &cfg.Telemetry.Exporter)
+	str("OTEL_EXPORTER_OTLP_PROTOCOL", &cfg.Telemetry.Protocol)
+	str("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Telemetry.Endpoint)
+	boolean("OTEL_EXPORTER_OTLP_INSECURE", &cfg.Telemetry.Insecure)
+	str("TELEMETRY_FILE", &cfg.Telemetry.FilePath)
+	float("TRACE_SAMPLE_RATIO", &cfg.Telemetry.SampleRatio)
+	switch strings.ToLower(os.Getenv("OTEL_TRACES_SAMPLER")) {
+	case "always_on":
+		cfg.Telemetry.SampleRatio = 1
+	case "always_off":
+		cfg.Telemetry.SampleRatio = 0
+	}
+	str("SERVICE_NAME", &cfg.Telemetry.ServiceName)
+	str("GO_ENV", &cfg.Telemetry.Environment)
+	str("ENV", &cfg.Telemetry.Environment)
+	boolean("TELEMETRY_METRICS_ENABLED", &cfg.Telemetry.Metrics)
+	boolean("TELEMETRY_LOGS_ENABLED", &cfg.Telemetry.Logs)
+
+	boolean("OPENAPI_VALIDATE_REQUESTS", &cfg.OpenAPI.ValidateRequests)
+	str("OPENAPI_VALIDATE_RESPONSES", &cfg.OpenAPI.ValidateResponses)
+
+	str("OUTBOX_SINK", &cfg.Outbox.Sink)
+	duration("OUTBOX_POLL_INTERVAL", &cfg.Outbox.PollInterval)
+	integer("OUTBOX_BATCH_SIZE", &cfg.Outbox.BatchSize)
+	duration("OUTBOX_RETENTION", &cfg.Outbox.Retention)
+	integer("OUTBOX_MAX_ATTEMPTS", &cfg.Outbox.MaxAttempts)
+	duration("OUTBOX_BACKOFF_MAX", &cfg.Outbox.BackoffMax)
+	str("OUTBOX_REDIS_STREAM", &cfg.Outbox.RedisStream)
+	integer("OUTBOX_REDIS_MAX_LEN", &cfg.Outbox.RedisMaxLen)
+	str("OUTBOX_WEBHOOK_URL", &cfg.Outbox.WebhookURL)
+	duration("OUTBOX_WEBHOOK_TIMEOUT", &cfg.Outbox.WebhookTimeout)
+
+	boolean("WEBHOOKS_ENABLED", &cfg.Webhooks.Enabled)
+	duration("WEBHOOKS_POLL_INTERVAL", &cfg.Webhooks.PollInterval)
+	integer("WEBHOOKS_BATCH_SIZE", &cfg.Webhooks.BatchSize)
+	integer("WEBHOOKS_MAX_ATTEMPTS", &cfg.Webhooks.MaxAttempts)
+	duration("WEBHOOKS_BACKOFF_BASE", &cfg.Webhooks.BackoffBase)
+	duration("WEBHOOKS_BACKOFF_MAX", &cfg.Webhooks.BackoffMax)
+	duration("WEBHOOKS_TIMEOUT", &cfg.Webhooks.Timeout)
+	boolean("WEBHOOKS_ALLOW_PRIVATE_TARGETS", &cfg.Webhooks.AllowPrivateTargets)
+
+	return errors.Join(errs...)
+}
+
+// 設定値の整合性を検証する
+func (c *Config) Validate() error {
+	var errs []error
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be 1-65535: %q", c.Server.Port))
+	}
+	if c.Server.RequestTimeout <= 0 {
+		errs = append(errs, errors.New("server.request_timeout must be positive"))
+	}
+	if c.Server.ShutdownDrainDelay < 0 {
+		errs = append(errs, errors.New("server.shutdown_drain_delay must not be negative"))
+	}
+	for key, d := range c.Server.Timeouts {
+		if _, _, isRoute := SplitRouteKey(key); (isRoute && d < 0) || (!isRoute && d <= 0) {
+			errs = append(errs, fmt.Errorf("server.timeouts[%q] must be positive", key))
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("server.max_body_bytes must be positive"))
+	}
+	if _, err := mysql.ParseDSN(c.Database.URL); err != nil {
+		errs = append(errs, fmt.Errorf("database.url is invalid: %w", err))
+	}
+	if c.Database.MaxOpenConns <= 0 {
+		errs = append(errs, errors.New("database.max_open_conns must be positive"))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns must be between 0 and max_open_conns"))
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database.conn_max_lifetime must not be negative"))
+	}
+	if c.Database.ReplicaURL != "" {
+		if _, err := mysql.ParseDSN(c.Database.ReplicaURL); err != nil {
+			errs = append(errs, fmt.Errorf("database.replica_url is invalid: %w", err))
+		}
+		if c.Database.ReplicaMaxLag <= 0 {
+			errs = append(errs, errors.New("database.replica_max_lag must be positive"))
+		}
+		if c.Database.ReplicaCheckInterval <= 0 {
+			errs = append(errs, errors.New("database.replica_check_interval must be positive"))
+		}
+	}
+	if c.Redis.Addr == "" {
+		errs = append(errs, errors.New("redis.addr is required"))
+	}
+	if c.Auth.RobotAPIKey == "" {
+		errs = append(errs, errors.New("auth.robot_api_key is required"))
+	}
+	switch strings.ToLower(c.Image.Store) {
+	case "fs":
+		if c.Image.Dir == "" {
+			errs = append(errs, errors.New("image.dir is required when image.store is fs"))
+		}
+	case "s3":
+		if c.Image.S3.Endpoint == "" || c.Image.S3.Bucket == "" {
+			errs = append(errs, errors.New("image.s3.endpoint and image.s3.bucket are required when image.store is s3"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("image.store must be fs or s3: %q", c.Image.Store))
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error: %q", c.Log.Level))
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("log.format must be json or text: %q", c.Log.Format))
+	}
+	if c.Telemetry.Enabled {
+		switch strings.ToLower(c.Telemetry.Exporter) {
+		case "otlp":
+			switch strings.ToLower(c.Telemetry.Protocol) {
+			case "grpc", "http", "http/protobuf":
+			default:
+				errs = append(errs, fmt.Errorf("telemetry.protocol must be grpc or http: %q", c.Telemetry.Protocol))
+			}
+			if c.Telemetry.Endpoint == "" {
+				errs = append(errs, errors.New("telemetry.endpoint is required when telemetry.exporter is otlp"))
+			}
+		case "stdout":
+		case "file":
+			if c.Telemetry.FilePath == "" {
+				errs = append(errs, errors.New("telemetry.file_path is required when telemetry.exporter is file"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("telemetry.exporter must be otlp, stdout or file: %q", c.Telemetry.Exporter))
+		}
+	}
+	if c.Telemetry.SampleRatio < 0 || c.Telemetry.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("telemetry.sample_ratio must be between 0 and 1: %v", c.Telemetry.SampleRatio))
+	}
+	switch c.OpenAPI.ValidateResponses {
+	case "off", "log", "strict":
+	default:
+		errs = append(errs, fmt.Errorf("openapi.validate_responses must be off, log or strict: %q", c.OpenAPI.ValidateResponses))
+	}
+	switch sink := strings.ToLower(c.Outbox.Sink); sink {
+	case "none", "log", "redis", "webhook":
+		if sink == "none" && !c.Webhooks.Enabled {
+			break
+		}
+		if c.Outbox.PollInterval <= 0 {
+			errs = append(errs, errors.New("outbox.poll_interval must be positive"))
+		}
+		if c.Outbox.BatchSize <= 0 {
+			errs = append(errs, errors.New("outbox.batch_size must be positive"))
+		}
+		if c.Outbox.Retention < 0 {
+			errs = append(errs, errors.New("outbox.retention must not be negative"))
+		}
+		if c.Outbox.MaxAttempts <= 0 {
+			errs = append(errs, errors.New("outbox.max_attempts must be positive"))
+		}
+		if c.Outbox.BackoffMax < c.Outbox.PollInterval {
+			errs = append(errs, errors.New("outbox.backoff_max must not be less than outbox.poll_interval"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("outbox.sink must be log, redis, webhook or none: %q", c.Outbox.Sink))
+	}
+	switch strings.ToLower(c.Outbox.Sink) {
+	case "redis":
+		if c.Outbox.RedisStream == "" || c.Outbox.RedisMaxLen <= 0 {
+			errs = append(errs, errors.New("outbox.redis_stream and a positive outbox.redis_max_len are required when outbox.sink is redis"))
+		}
+	case "webhook":
+		if u, err := url.Parse(c.Outbox.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("outbox.webhook_url must be an http(s) url when outbox.sink is webhook: %q", c.Outbox.WebhookURL))
+		}
+		if c.Outbox.WebhookTimeout <= 0 {
+			errs = append(errs, errors.New("outbox.webhook_timeout must be positive"))
+		}
+	}
+	if c.Webhooks.Enabled {
+		if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 {
+			errs = append(errs, errors.New("webhooks.poll_interval and webhooks.timeout must be positive"))
+		}
+		if c.Webhooks.BatchSize <= 0 || c.Webhooks.MaxAttempts <= 0 {
+			errs = append(errs, errors.New("webhooks.batch_size and webhooks.max_attempts must be positive"))
+		}
+		if c.Webhooks.BackoffBase <= 0 || c.Webhooks.BackoffMax < c.Webhooks.BackoffBase {
+			errs = append(errs, errors.New("webhooks.backoff_base must be positive and not greater than webhooks.backoff_max"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 秘密情報を伏せたコピーを返す
+func (c Config) Redacted() Config {
+	c.Database.URL = redactDSN(c.Database.URL)
+	if c.Database.ReplicaURL != "" {
+		c.Database.ReplicaURL = redactDSN(c.Database.ReplicaURL)
+	}
+	c.Redis.Password = redactSecret(c.Redis.Password)
+	c.Auth.RobotAPIKey = redactSecret(c.Auth.RobotAPIKey)
+	c.Image.S3.AccessKey = redactSecret(c.Image.S3.AccessKey)
+	c.Image.S3.SecretKey = redactSecret(c.Image.S3.SecretKey)
+	c.Outbox.WebhookURL = redactURL(c.Outbox.WebhookURL)
+	return c
+}
+
+// 秘密情報を伏せたJSON文字列 (起動時のログ出力用)
+func (c Config) String() string {
+	b, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("<config: %v>", err)
+	}
+	return string(b)
+}
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// DSNのパスワード部分を伏せる
+func redactDSN(dsn string) string {
+	parsed, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if parsed.Passwd != "" {
+		parsed.Passwd = redacted
+	}
+	return parsed.FormatDSN()
+}
+
+// URLのパスワードとクエリ(トークンを含むことがある)を伏せる
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redactSecret(s)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.Redacted()
+}
+
+// "キー=時間"をカンマで区切った形式のタイムアウトを解析する
+func parseTimeouts(v string) (map[string]Duration, error) {
+	timeouts := make(map[string]Duration)
+	for _, part := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid entry %q: expected key=duration", part)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %q: %w", part, err)
+		}
+		timeouts[key] = Duration(d)
+	}
+	return timeouts, nil
+}
+
+// タイムアウトのキーがルート("METHOD /pattern")ならメソッドとパターンに分ける
+func SplitRouteKey(key string) (method, pattern string, ok bool) {
+	method, pattern, ok = strings.Cut(key, " ")
+	if !ok || method == "" || !strings.HasPrefix(pattern, "/") {
+		return "", "", false
+	}
+	return strings.ToUpper(method), pattern, true
+}
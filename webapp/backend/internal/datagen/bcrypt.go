@@ -0,0 +1,47 @@
+package datagen
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/blowfish"
+)
+
+// bcryptと同じ並びのbase64 (パディングなし)
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// bcryptの暗号化対象の固定文字列
+var bcryptMagic = []byte("OrpheanBeholderScryDoubt")
+
+// ソルトを指定してbcryptハッシュ($2a$)を計算する
+// golang.org/x/crypto/bcryptはソルトを乱数で決めるため、シードから同じハッシュを再現できるよう自前で計算する
+// 結果はbcrypt.CompareHashAndPasswordでそのまま検証できる
+func bcryptHash(password []byte, cost int, salt [16]byte) string {
+	key := make([]byte, 0, len(password)+1)
+	key = append(key, password...)
+	key = append(key, 0)
+	if len(key) > 72 {
+		key = key[:72]
+	}
+
+	c, err := blowfish.NewSaltedCipher(key, salt[:])
+	if err != nil {
+		// 鍵長は1~72バイトに収めているため起こらない
+		panic(err)
+	}
+	for i := uint64(0); i < 1<<cost; i++ {
+		blowfish.ExpandKey(key, c)
+		blowfish.ExpandKey(salt[:], c)
+	}
+
+	data := make([]byte, len(bcryptMagic))
+	copy(data, bcryptMagic)
+	for i := 0; i < len(data); i += 8 {
+		for range 64 {
+			c.Encrypt(data[i:i+8], data[i:i+8])
+		}
+	}
+
+	// 最後の1バイトは出力しない (他の実装と互換にするため)
+	return fmt.Sprintf("$2a$%02d$%s%s", cost, bcryptEncoding.EncodeToString(salt[:]), bcryptEncoding.EncodeToString(data[:23]))
+}
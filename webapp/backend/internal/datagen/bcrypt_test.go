@@ -0,0 +1,116 @@
+package datagen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHashMatchesBcrypt(t *testing.T) {
+	passwords := []string{"password", "", "パスワード", strings.Repeat("a", 72)}
+	for _, password := range passwords {
+		for _, cost := range []int{bcrypt.MinCost, bcrypt.MinCost + 1} {
+			var salt [16]byte
+			copy(salt[:], password+"0123456789abcdef")
+			hash := bcryptHash([]byte(password), cost, salt)
+
+			if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+				t.Errorf("CompareHashAndPassword(%q, cost %d) = %v", password, cost, err)
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password+"x")); err == nil && len(password) < 72 {
+				t.Errorf("hash of %q also matches %q", password, password+"x")
+			}
+			if got, err := bcrypt.Cost([]byte(hash)); err != nil || got != cost {
+				t.Errorf("Cost() = %d, %v, want %d", got, err, cost)
+			}
+		}
+	}
+}
+
+// OpenwallのBcryptのテストベクター
+func TestBcryptHashKnownVector(t *testing.T) {
+	const want = "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"
+	raw, err := bcryptEncoding.DecodeString("CCCCCCCCCCCCCCCCCCCCC.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var salt [16]byte
+	copy(salt[:], raw)
+	if got := bcryptHash([]byte("U*U"), 5, salt); got != want {
+		t.Errorf("bcryptHash() = %s, want %s", got, want)
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Users, cfg.Products, cfg.Orders = 20, 50, 300
+	cfg.BcryptCost = bcrypt.MinCost
+
+	dump := func(cfg Config) string {
+		t.Helper()
+		ds, err := Generate(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteSQL(&buf, ds); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	first := dump(cfg)
+	if second := dump(cfg); first != second {
+		t.Error("Generate returned different data for the same seed")
+	}
+	other := cfg
+	other.Seed++
+	if dump(other) == first {
+		t.Error("Generate returned the same data for a different seed")
+	}
+
+	// 注文の件数を変えても、ユーザーと商品は変わらない
+	more := cfg
+	more.Orders *= 2
+	a, err := Generate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Generate(more)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range a.Users {
+		if a.Users[i] != b.Users[i] {
+			t.Fatalf("user %d changed with the order count: %+v != %+v", i, a.Users[i], b.Users[i])
+		}
+	}
+	for i := range a.Products {
+		if a.Products[i] != b.Products[i] {
+			t.Fatalf("product %d changed with the order count: %+v != %+v", i, a.Products[i], b.Products[i])
+		}
+	}
+}
+
+func TestGenerateOrderRequestsIsDeterministic(t *testing.T) {
+	dump := func(seed int64) string {
+		t.Helper()
+		reqs, err := GenerateOrderRequests(seed, 100, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteOrderRequests(&buf, reqs); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if dump(1) != dump(1) {
+		t.Error("GenerateOrderRequests returned different requests for the same seed")
+	}
+	if dump(1) == dump(2) {
+		t.Error("GenerateOrderRequests returned the same requests for a different seed")
+	}
+}
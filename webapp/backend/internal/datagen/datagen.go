@@ -0,0 +1,306 @@
+// シードから再現可能なテストデータ(ユーザー・商品・注文)を生成する
+// 同じConfigからは、パスワードハッシュも含めて常に同じデータが生成される
+package datagen
+
+import (
+	"backend/internal/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 注文ステータスとその出現比率
+type StatusWeight struct {
+	Status string
+	Weight int
+}
+
+// 注文ステータスの既定の比率
+var DefaultStatusMix = []StatusWeight{
+	{Status: "shipping", Weight: 60},
+	{Status: "delivering", Weight: 10},
+	{Status: "completed", Weight: 30},
+}
+
+var validStatuses = []string{"shipping", "delivering", "completed"}
+
+// "shipping=60,delivering=10,completed=30"の形式の比率を解析する
+func ParseStatusMix(s string) ([]StatusWeight, error) {
+	var mix []StatusWeight
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		status, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid status mix %q: expected status=weight", part)
+		}
+		if !slices.Contains(validStatuses, status) {
+			return nil, fmt.Errorf("invalid status %q: must be one of %s", status, strings.Join(validStatuses, ", "))
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q for status %q", weight, status)
+		}
+		mix = append(mix, StatusWeight{Status: status, Weight: w})
+		total += w
+	}
+	if total == 0 {
+		return nil, errors.New("status mix must have a positive total weight")
+	}
+	return mix, nil
+}
+
+// ParseStatusMixと同じ形式で表す
+func FormatStatusMix(mix []StatusWeight) string {
+	parts := make([]string, len(mix))
+	for i, sw := range mix {
+		parts[i] = fmt.Sprintf("%s=%d", sw.Status, sw.Weight)
+	}
+	return strings.Join(parts, ",")
+}
+
+// 注文日時の既定の上限 (実行日時に依存しないよう固定する)
+var DefaultUntil = time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// 生成の設定
+type Config struct {
+	Seed     int64
+	Users    int
+	Products int
+	Orders   int
+
+	// 全ユーザー共通のパスワードとbcryptのコスト
+	Password   string
+	BcryptCost int
+
+	StatusMix []StatusWeight
+	// 注文日時はUntilまでのSpanの範囲に分布させる
+	Until time.Time
+	Span  time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Seed:       1,
+		Users:      100,
+		Products:   1000,
+		Orders:     5000,
+		Password:   "password",
+		BcryptCost: bcrypt.DefaultCost,
+		StatusMix:  DefaultStatusMix,
+		Until:      DefaultUntil,
+		Span:       30 * 24 * time.Hour,
+	}
+}
+
+func (c Config) validate() error {
+	if c.Users < 0 || c.Products < 0 || c.Orders < 0 {
+		return errors.New("counts must not be negative")
+	}
+	if c.Orders > 0 && (c.Users == 0 || c.Products == 0) {
+		return errors.New("orders require at least one user and one product")
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if len(c.Password) > 72 {
+		return errors.New("password must be at most 72 bytes")
+	}
+	if c.Span <= 0 {
+		return errors.New("span must be positive")
+	}
+	return nil
+}
+
+// 生成したデータ
+// IDは1からの連番で、注文は作成日時の順に並ぶ
+type Dataset struct {
+	Users    []model.User
+	Products []model.Product
+	Orders   []model.Order
+}
+
+// 種類ごとの乱数列
+// 件数を変えても他の種類の内容が変わらないよう、別々の乱数列を使う
+const (
+	streamUsers = iota + 1
+	streamProducts
+	streamOrders
+	streamOrderRequests
+)
+
+func newRand(seed int64, stream int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed*1_000_003 + stream))
+}
+
+// データを生成する
+func Generate(cfg Config) (*Dataset, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	ds := &Dataset{
+		Users:    generateUsers(cfg),
+		Products: generateProducts(cfg),
+	}
+	ds.Orders = generateOrders(cfg, ds.Products)
+	return ds, nil
+}
+
+func generateUsers(cfg Config) []model.User {
+	rng := newRand(cfg.Seed, streamUsers)
+	users := make([]model.User, cfg.Users)
+	salts := make([][16]byte, cfg.Users)
+	for i := range users {
+		users[i] = model.User{
+			UserID:   i + 1,
+			UserName: fmt.Sprintf("%s%05d", familyNames[rng.Intn(len(familyNames))], i+1),
+			Role:     model.RoleCustomer,
+		}
+		rng.Read(salts[i][:])
+	}
+
+	// ハッシュの計算は重いので並列に行う (ソルトは先に決めてあるため結果は変わらない)
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				users[i].PasswordHash = bcryptHash([]byte(cfg.Password), cfg.BcryptCost, salts[i])
+			}
+		}()
+	}
+	for i := range users {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return users
+}
+
+func generateProducts(cfg Config) []model.Product {
+	rng := newRand(cfg.Seed, streamProducts)
+	products := make([]model.Product, cfg.Products)
+	for i := range products {
+		c := categories[rng.Intn(len(categories))]
+
+		// 重さは対数正規分布 (軽いものが多く、まれに重いものがある)
+		weight := int(math.Round(c.medianWeight * math.Exp(rng.NormFloat64()*0.6)))
+		weight = min(max(weight, 1), 50)
+		// 価値は重さにおおむね比例させ、ばらつきを持たせて10円単位に丸める
+		value := int(math.Round(float64(weight)*c.valuePerKg*math.Exp(rng.NormFloat64()*0.5)/10)) * 10
+		value = max(value, 10)
+
+		noun := c.nouns[rng.Intn(len(c.nouns))]
+		name := fmt.Sprintf("%s%s %s 型式%c%c-%d",
+			adjectives[rng.Intn(len(adjectives))], noun, series[rng.Intn(len(series))],
+			kana[rng.Intn(len(kana))], kana[rng.Intn(len(kana))], 10+rng.Intn(990))
+		description := fmt.Sprintf("%sの%s。%s。",
+			features[rng.Intn(len(features))], noun, usages[rng.Intn(len(usages))])
+
+		products[i] = model.Product{
+			ProductID:   i + 1,
+			Name:        name,
+			Value:       value,
+			Weight:      weight,
+			Description: description,
+		}
+	}
+	return products
+}
+
+func generateOrders(cfg Config, products []model.Product) []model.Order {
+	if cfg.Orders == 0 {
+		return nil
+	}
+	rng := newRand(cfg.Seed, streamOrders)
+
+	// 注文はよく買うユーザー・よく売れる商品に偏らせる (Zipf分布)
+	// 人気の商品がIDの小さいものに偏らないよう、順位と商品の対応はシャッフルする
+	userZipf := rand.NewZipf(rng, 1.1, 2, uint64(cfg.Users-1))
+	productZipf := rand.NewZipf(rng, 1.1, 5, uint64(len(products)-1))
+	popularity := rng.Perm(len(products))
+
+	totalWeight := 0
+	for _, sw := range cfg.StatusMix {
+		totalWeight += sw.Weight
+	}
+
+	orders := make([]model.Order, cfg.Orders)
+	for i := range orders {
+		p := products[popularity[productZipf.Uint64()]]
+		createdAt := cfg.Until.Add(-time.Duration(rng.Int63n(int64(cfg.Span)))).Truncate(time.Second)
+
+		status := cfg.StatusMix[len(cfg.StatusMix)-1].Status
+		r := rng.Intn(totalWeight)
+		for _, sw := range cfg.StatusMix {
+			if r < sw.Weight {
+				status = sw.Status
+				break
+			}
+			r -= sw.Weight
+		}
+
+		var arrivedAt sql.NullTime
+		if status == "completed" {
+			// 配達までは1時間から3日で、Untilより後にはしない
+			arrived := createdAt.Add(time.Hour + time.Duration(rng.Int63n(int64(71*time.Hour)))).Truncate(time.Second)
+			if arrived.After(cfg.Until) {
+				arrived = cfg.Until
+			}
+			arrivedAt = sql.NullTime{Time: arrived, Valid: true}
+		}
+
+		orders[i] = model.Order{
+			UserID:        int(userZipf.Uint64()) + 1,
+			ProductID:     p.ProductID,
+			ProductName:   p.Name,
+			ShippedStatus: status,
+			Weight:        p.Weight,
+			Value:         p.Value,
+			CreatedAt:     createdAt,
+			ArrivedAt:     arrivedAt,
+		}
+	}
+
+	// AUTO_INCREMENTと同じく、注文IDは作成日時の順に振る
+	slices.SortStableFunc(orders, func(a, b model.Order) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	for i := range orders {
+		orders[i].OrderID = int64(i + 1)
+	}
+	return orders
+}
+
+// 注文作成APIのリクエストボディを生成する (負荷試験のシナリオデータ用)
+// 1件あたり1~5商品、各商品の数量は1~10個
+func GenerateOrderRequests(seed int64, n, products int) ([]model.CreateOrderRequest, error) {
+	if n < 0 {
+		return nil, errors.New("count must not be negative")
+	}
+	if n > 0 && products <= 0 {
+		return nil, errors.New("order requests require at least one product")
+	}
+	rng := newRand(seed, streamOrderRequests)
+	reqs := make([]model.CreateOrderRequest, n)
+	for i := range reqs {
+		items := make([]model.RequestItem, 1+rng.Intn(5))
+		for j := range items {
+			items[j] = model.RequestItem{
+				ProductID: 1 + rng.Intn(products),
+				Quantity:  1 + rng.Intn(10),
+			}
+		}
+		reqs[i].Items = items
+	}
+	return reqs, nil
+}
@@ -0,0 +1,134 @@
+package datagen
+
+import (
+	"backend/internal/model"
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 1つのINSERT文にまとめる行数
+const sqlBatchSize = 500
+
+const mysqlTimeFormat = "2006-01-02 15:04:05"
+
+// INSERT文のSQLとして書き出す
+// IDを明示して挿入するため、空のテーブルに流し込むことを想定している
+func WriteSQL(w io.Writer, ds *Dataset) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "SET NAMES utf8mb4;")
+
+	userRows := make([][]string, len(ds.Users))
+	for i, u := range ds.Users {
+		userRows[i] = []string{strconv.Itoa(u.UserID), sqlString(u.PasswordHash), sqlString(u.UserName), sqlString(u.Role)}
+	}
+	writeInserts(bw, "users", []string{"user_id", "password_hash", "user_name", "role"}, userRows)
+
+	productRows := make([][]string, len(ds.Products))
+	for i, p := range ds.Products {
+		productRows[i] = []string{strconv.Itoa(p.ProductID), sqlString(p.Name), strconv.Itoa(p.Value), strconv.Itoa(p.Weight), sqlString(p.Image), sqlString(p.Description)}
+	}
+	writeInserts(bw, "products", []string{"product_id", "name", "value", "weight", "image", "description"}, productRows)
+
+	orderRows := make([][]string, len(ds.Orders))
+	for i, o := range ds.Orders {
+		arrivedAt := "NULL"
+		if o.ArrivedAt.Valid {
+			arrivedAt = sqlString(o.ArrivedAt.Time.UTC().Format(mysqlTimeFormat))
+		}
+		orderRows[i] = []string{
+			strconv.FormatInt(o.OrderID, 10), strconv.Itoa(o.UserID), strconv.Itoa(o.ProductID), sqlString(o.ShippedStatus),
+			sqlString(o.CreatedAt.UTC().Format(mysqlTimeFormat)), arrivedAt,
+		}
+	}
+	writeInserts(bw, "orders", []string{"order_id", "user_id", "product_id", "shipped_status", "created_at", "arrived_at"}, orderRows)
+
+	return bw.Flush()
+}
+
+func writeInserts(w *bufio.Writer, table string, columns []string, rows [][]string) {
+	for start := 0; start < len(rows); start += sqlBatchSize {
+		end := min(start+sqlBatchSize, len(rows))
+		fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES\n", table, strings.Join(columns, ", "))
+		for i, row := range rows[start:end] {
+			sep := ","
+			if start+i == end-1 {
+				sep = ";"
+			}
+			fmt.Fprintf(w, "  (%s)%s\n", strings.Join(row, ", "), sep)
+		}
+	}
+}
+
+// MySQLの文字列リテラルにする
+func sqlString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `''`)
+	return "'" + s + "'"
+}
+
+// テーブルごとのCSV(users.csv, products.csv, orders.csv)としてdirに書き出す
+// NULLはLOAD DATA INFILEと同じく\Nで表す
+func WriteCSV(dir string, ds *Dataset) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	users := [][]string{{"user_id", "password_hash", "user_name", "role"}}
+	for _, u := range ds.Users {
+		users = append(users, []string{strconv.Itoa(u.UserID), u.PasswordHash, u.UserName, u.Role})
+	}
+	products := [][]string{{"product_id", "name", "value", "weight", "image", "description"}}
+	for _, p := range ds.Products {
+		products = append(products, []string{strconv.Itoa(p.ProductID), p.Name, strconv.Itoa(p.Value), strconv.Itoa(p.Weight), p.Image, p.Description})
+	}
+	orders := [][]string{{"order_id", "user_id", "product_id", "shipped_status", "created_at", "arrived_at"}}
+	for _, o := range ds.Orders {
+		orders = append(orders, []string{
+			strconv.FormatInt(o.OrderID, 10), strconv.Itoa(o.UserID), strconv.Itoa(o.ProductID), o.ShippedStatus,
+			o.CreatedAt.UTC().Format(mysqlTimeFormat), csvTime(o.ArrivedAt),
+		})
+	}
+
+	for name, records := range map[string][][]string{"users.csv": users, "products.csv": products, "orders.csv": orders} {
+		if err := writeCSVFile(filepath.Join(dir, name), records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func csvTime(t sql.NullTime) string {
+	if !t.Valid {
+		return `\N`
+	}
+	return t.Time.UTC().Format(mysqlTimeFormat)
+}
+
+func writeCSVFile(path string, records [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// 注文作成APIのリクエストボディの一覧をJSONで書き出す
+func WriteOrderRequests(w io.Writer, reqs []model.CreateOrderRequest) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reqs)
+}
@@ -0,0 +1,52 @@
+package datagen
+
+// 商品のカテゴリ
+// 重さの中央値と、重さあたりの価値の中央値でカテゴリごとの分布を決める
+type category struct {
+	nouns        []string
+	medianWeight float64
+	valuePerKg   float64
+}
+
+var categories = []category{
+	{nouns: []string{"ワイヤレスイヤホン", "モバイルバッテリー", "USBメモリ", "スマートウォッチ", "充電ケーブル"}, medianWeight: 1, valuePerKg: 4000},
+	{nouns: []string{"ノートパソコン", "タブレット", "ポータブルSSD", "デジタルカメラ", "ゲーム機"}, medianWeight: 3, valuePerKg: 9000},
+	{nouns: []string{"電子レンジ", "炊飯器", "空気清浄機", "コーヒーメーカー", "掃除機"}, medianWeight: 8, valuePerKg: 1500},
+	{nouns: []string{"オフィスチェア", "本棚", "ローテーブル", "収納ボックス", "デスクライト"}, medianWeight: 15, valuePerKg: 600},
+	{nouns: []string{"米", "ミネラルウォーター", "缶コーヒー", "レトルトカレー", "緑茶"}, medianWeight: 6, valuePerKg: 300},
+	{nouns: []string{"文庫本", "ノート", "ボールペン", "手帳", "付箋"}, medianWeight: 1, valuePerKg: 800},
+}
+
+var adjectives = []string{
+	"高耐久", "軽量", "静音", "コンパクト", "プレミアム", "業務用", "省エネ", "多機能", "折りたたみ式", "防水",
+}
+
+var series = []string{"第一世代", "第二世代", "第三世代", "スタンダード", "プロ", "ライト", "エクストラ"}
+
+// 型番に使うカタカナ
+var kana = []rune("アイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワ")
+
+// 商品説明の文
+var usages = []string{
+	"オフィスでの長時間の作業でも快適に使えます",
+	"持ち運びやすく、出張や旅行にも最適です",
+	"毎日の家事をしっかりサポートします",
+	"在宅勤務の環境づくりに役立ちます",
+	"贈り物にも喜ばれる定番の一品です",
+	"初めての方でも簡単に使いこなせます",
+}
+
+var features = []string{
+	"耐久性を高めた新設計",
+	"前モデルより軽量化",
+	"使いやすさを追求したデザイン",
+	"省スペースで設置可能",
+	"メンテナンスが簡単",
+	"安心の国内品質検査済み",
+}
+
+// ユーザー名に使う姓
+var familyNames = []string{
+	"sato", "suzuki", "takahashi", "tanaka", "watanabe", "ito", "yamamoto", "nakamura", "kobayashi", "kato",
+	"yoshida", "yamada", "sasaki", "yamaguchi", "matsumoto", "inoue", "kimura", "hayashi", "shimizu", "yamazaki",
+}
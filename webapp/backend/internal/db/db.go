@@ -1,29 +1,29 @@
 package db
 
 import (
+	"backend/internal/config"
 	"backend/internal/telemetry"
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
-func InitDBConnection() (*sqlx.DB, error) {
-	dbUrl := os.Getenv("DATABASE_URL")
-	if dbUrl == "" {
-		dbUrl = "user:password@tcp(db:4306)/hiroshimauniv2511-db"
+func InitDBConnection(cfg config.DatabaseConfig) (*sqlx.DB, error) {
+	sep := "?"
+	if strings.Contains(cfg.URL, "?") {
+		sep = "&"
 	}
-	dsn := fmt.Sprintf("%s?charset=utf8mb4&parseTime=True&loc=UTC", dbUrl)
-	log.Printf(dsn)
+	dsn := cfg.URL + sep + "charset=utf8mb4&parseTime=True&loc=UTC"
 
 	driverName := telemetry.WrapSQLDriver("mysql")
 	dbConn, err := sqlx.Open(driverName, dsn)
 	if err != nil {
-		log.Printf("Failed to open database connection: %v", err)
+		slog.Error("failed to open database connection", "error", err)
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
@@ -32,14 +32,14 @@ func InitDBConnection() (*sqlx.DB, error) {
 	err = dbConn.PingContext(ctx)
 	if err != nil {
 		dbConn.Close()
-		log.Printf("Failed to connect to database: %v", err)
+		slog.Error("failed to connect to database", "error", err)
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-	log.Println("Successfully connected to MySQL!")
+	slog.Info("connected to mysql")
 
-	dbConn.SetMaxOpenConns(25)
-	dbConn.SetMaxIdleConns(10)
-	dbConn.SetConnMaxLifetime(0)
+	dbConn.SetMaxOpenConns(cfg.MaxOpenConns)
+	dbConn.SetMaxIdleConns(cfg.MaxIdleConns)
+	dbConn.SetConnMaxLifetime(cfg.ConnMaxLifetime.Std())
 
 	return dbConn, nil
 }
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"backend/internal/config"
+	"backend/internal/metrics"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// レプリカに接続する (接続プールの設定はプライマリと共通)
+func InitReplicaConnection(cfg config.DatabaseConfig) (*sqlx.DB, error) {
+	cfg.URL = cfg.ReplicaURL
+	dbConn, err := InitDBConnection(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("replica: %w", err)
+	}
+	return dbConn, nil
+}
+
+// レプリカの遅延を定期的に確認し、読み取りに使ってよいかを判定する
+type ReplicaMonitor struct {
+	db       *sqlx.DB
+	maxLag   time.Duration
+	interval time.Duration
+
+	healthy atomic.Bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewReplicaMonitor(db *sqlx.DB, maxLag, interval time.Duration) *ReplicaMonitor {
+	return &ReplicaMonitor{
+		db:       db,
+		maxLag:   maxLag,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// 初回の確認を行ってから、バックグラウンドで定期的な確認を始める
+func (m *ReplicaMonitor) Start(ctx context.Context) {
+	m.check(ctx)
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.check(context.Background())
+			}
+		}
+	}()
+}
+
+// 定期的な確認を止める
+func (m *ReplicaMonitor) Stop(ctx context.Context) error {
+	close(m.stop)
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// レプリカから読んでよいか (遅延が上限以内で、接続できる)
+func (m *ReplicaMonitor) Healthy() bool {
+	return m.healthy.Load()
+}
+
+func (m *ReplicaMonitor) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	lag, err := replicaLag(ctx, m.db)
+	healthy := err == nil && lag <= m.maxLag
+	if err != nil {
+		metrics.SetReplicaLag(-1)
+	} else {
+		metrics.SetReplicaLag(lag.Seconds())
+	}
+
+	// 状態が変わったときだけログを出す
+	if m.healthy.Swap(healthy) != healthy {
+		if healthy {
+			slog.Info("replica is healthy, routing reads to it", "lag", lag)
+		} else {
+			slog.Warn("replica is unhealthy, routing reads to primary", "lag", lag, "max_lag", m.maxLag, "error", err)
+		}
+	}
+}
+
+// SHOW REPLICA STATUSのSeconds_Behind_Sourceから遅延を取得する
+// レプリケーションの設定がない場合(読み取り専用のプロキシ等)は遅延0とみなす
+func replicaLag(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+	rows, err := db.QueryxContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+	var seconds sql.NullString
+	if err := seconds.Scan(status["Seconds_Behind_Source"]); err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		// レプリケーションが止まっている
+		return 0, errors.New("replication is not running")
+	}
+	n, err := strconv.ParseInt(seconds.String, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Seconds_Behind_Source %q: %w", seconds.String, err)
+	}
+	return time.Duration(n) * time.Second, nil
+}
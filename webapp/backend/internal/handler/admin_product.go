@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// 管理者向けの商品管理API
+type AdminProductHandler struct {
+	ProductSvc *service.ProductService
+	ImageSvc   *service.ImageService
+}
+
+func NewAdminProductHandler(svc *service.ProductService, imageSvc *service.ImageService) *AdminProductHandler {
+	return &AdminProductHandler{ProductSvc: svc, ImageSvc: imageSvc}
+}
+
+// アップロードを許可する画像の最大サイズ
+const maxImageUploadSize = 10 << 20
+
+// 商品を1件取得
+func (h *AdminProductHandler) Get(w http.ResponseWriter, r *http.Request) {
+	productID, ok := productIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	product, err := h.ProductSvc.GetProduct(r.Context(), productID)
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// 商品を作成
+func (h *AdminProductHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req model.ProductInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.InvalidBody(w, err)
+		return
+	}
+
+	product, err := h.ProductSvc.CreateProduct(r.Context(), req)
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// 商品を更新
+func (h *AdminProductHandler) Update(w http.ResponseWriter, r *http.Request) {
+	productID, ok := productIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ProductInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.InvalidBody(w, err)
+		return
+	}
+
+	product, err := h.ProductSvc.UpdateProduct(r.Context(), productID, req)
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// 商品を論理削除
+func (h *AdminProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	productID, ok := productIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.ProductSvc.DeleteProduct(r.Context(), productID); err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 商品画像をアップロード (multipart/form-dataの"image"フィールド)
+func (h *AdminProductHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
+	productID, ok := productIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// multipartのヘッダー分の余裕を持たせる
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadSize+(1<<20))
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeImageTooLarge(w)
+			return
+		}
+		apierror.InvalidRequest(w, "field 'image' is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageUploadSize+1))
+	if err != nil {
+		apierror.InvalidRequest(w, "failed to read image")
+		return
+	}
+	if len(data) > maxImageUploadSize {
+		writeImageTooLarge(w)
+		return
+	}
+
+	image, err := h.ImageSvc.UploadProductImage(r.Context(), productID, data)
+	if errors.Is(err, service.ErrInvalidImage) {
+		apierror.Write(w, http.StatusUnsupportedMediaType, service.ErrInvalidImage.Code, service.ErrInvalidImage.Message, nil)
+		return
+	}
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+func productIDFromURL(w http.ResponseWriter, r *http.Request) (int, bool) {
+	productID, err := strconv.Atoi(chi.URLParam(r, "productID"))
+	if err != nil || productID <= 0 {
+		apierror.InvalidRequest(w, "invalid product ID")
+		return 0, false
+	}
+	return productID, true
+}
+
+func writeImageTooLarge(w http.ResponseWriter) {
+	apierror.Write(w, http.StatusRequestEntityTooLarge, "image_too_large",
+		fmt.Sprintf("image must be at most %d bytes", maxImageUploadSize), nil)
+}
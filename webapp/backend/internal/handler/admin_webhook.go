@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// 管理者向けのWebhook管理API
+type AdminWebhookHandler struct {
+	WebhookSvc *service.WebhookService
+}
+
+func NewAdminWebhookHandler(svc *service.WebhookService) *AdminWebhookHandler {
+	return &AdminWebhookHandler{WebhookSvc: svc}
+}
+
+// Webhookを登録 (署名用のSecretはこのレスポンスでのみ返す)
+func (h *AdminWebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req model.WebhookSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.InvalidBody(w, err)
+		return
+	}
+
+	sub, err := h.WebhookSvc.CreateSubscription(r.Context(), req)
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// Webhookの一覧
+func (h *AdminWebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.WebhookSvc.ListSubscriptions(r.Context())
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Data []model.WebhookSubscription `json:"data"`
+	}{Data: subs})
+}
+
+// Webhookを削除
+func (h *AdminWebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := webhookIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.WebhookSvc.DeleteSubscription(r.Context(), webhookID); err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 再試行の上限に達した配信の一覧
+func (h *AdminWebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := webhookIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	deadLetters, err := h.WebhookSvc.ListDeadLetters(r.Context(), webhookID)
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Data []model.WebhookDeadLetter `json:"data"`
+	}{Data: deadLetters})
+}
+
+// 再送待ちの配信を再送 (dead_letter_idsを省略した場合はすべて)
+func (h *AdminWebhookHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := webhookIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DeadLetterIDs []int64 `json:"dead_letter_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.InvalidBody(w, err)
+		return
+	}
+
+	n, err := h.WebhookSvc.Replay(r.Context(), webhookID, req.DeadLetterIDs)
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"replayed": n})
+}
+
+func webhookIDFromURL(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil || webhookID <= 0 {
+		apierror.InvalidRequest(w, "invalid webhook ID")
+		return 0, false
+	}
+	return webhookID, true
+}
@@ -2,49 +2,50 @@ package handler
 
 import (
 	"encoding/json"
-	"errors"
-	"log"
+	"fmt"
 	"net/http"
 
+	"backend/internal/apierror"
+	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
 )
 
 type AuthHandler struct {
 	AuthSvc *service.AuthService
+	Cookie  CookieConfig
+	Proxies TrustedProxies
 }
 
-func NewAuthHandler(authSvc *service.AuthService) *AuthHandler {
-	return &AuthHandler{AuthSvc: authSvc}
+func NewAuthHandler(authSvc *service.AuthService, cookieCfg CookieConfig, proxies TrustedProxies) *AuthHandler {
+	return &AuthHandler{AuthSvc: authSvc, Cookie: cookieCfg, Proxies: proxies}
 }
 
 // ログイン時にセッションを発行し、Cookieにセットする
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	log.Println("-> Received request for /api/login")
-
 	var req model.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.InvalidBody(w, err)
+		return
+	}
+
+	sessionID, expiresAt, err := h.AuthSvc.Login(r.Context(), req.UserName, req.Password, h.Proxies.ClientIP(r))
+	if err != nil {
+		// ロックアウト時はRetry-Afterを付与し、ユーザーの存在有無が推測できないメッセージのみ返す
+		apierror.WriteError(w, r, err)
 		return
 	}
 
-	sessionID, expiresAt, err := h.AuthSvc.Login(r.Context(), req.UserName, req.Password)
+	csrfToken, err := middleware.NewCSRFToken()
 	if err != nil {
-		if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrInvalidPassword) {
-			http.Error(w, "Unauthorized: Invalid credentials", http.StatusUnauthorized)
-		} else {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+		apierror.WriteError(w, r, fmt.Errorf("failed to generate CSRF token: %w", err))
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Expires:  expiresAt,
-		HttpOnly: true,
-		Path:     "/",
-	})
+	https := h.Proxies.IsHTTPS(r)
+	http.SetCookie(w, h.Cookie.newCookie(https, "session_id", sessionID, expiresAt, true))
+	// CSRFトークンはフロントエンドから読み取ってヘッダーに付与するためHttpOnlyにしない
+	http.SetCookie(w, h.Cookie.newCookie(https, middleware.CSRFCookieName, csrfToken, expiresAt, false))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
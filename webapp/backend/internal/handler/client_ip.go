@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// X-Real-IP / X-Forwarded-For / X-Forwarded-Protoを信頼するプロキシのアドレス範囲
+type TrustedProxies []netip.Prefix
+
+// IPアドレスまたはCIDRのリストを解析する
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(entries))
+	for _, e := range entries {
+		if prefix, err := netip.ParsePrefix(e); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", e)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return proxies, nil
+}
+
+func (t TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range t {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// リクエスト元のIPアドレスを取得する
+// 信頼するプロキシからの接続の場合のみ、nginxが設定するX-Real-IP / X-Forwarded-Forを使う
+// (それ以外の接続元はヘッダーを偽装して別のIPアドレスを名乗れるため)
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	host, trusted := t.fromProxy(r)
+	if !trusted {
+		return host
+	}
+
+	if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return ip.Unmap().String()
+	}
+	// 右端(最後に経由したプロキシが追加した値)から、信頼するプロキシ以外の最初のアドレスを探す
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = ip.Unmap().String()
+		if !t.contains(ip) {
+			break
+		}
+	}
+	if client != "" {
+		return client
+	}
+	return host
+}
+
+// HTTPSで受けたリクエストか
+// 信頼するプロキシからの接続の場合のみ、nginxが設定するX-Forwarded-Protoを使う
+func (t TrustedProxies) IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if _, trusted := t.fromProxy(r); !trusted {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+// 接続元のアドレスと、それが信頼するプロキシかを返す
+func (t TrustedProxies) fromProxy(r *http.Request) (string, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	return host, err == nil && t.contains(remote)
+}
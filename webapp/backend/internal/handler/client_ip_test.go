@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		xff        string
+		want       string
+	}{
+		{"direct client ignores headers", "203.0.113.5:1234", "198.51.100.1", "198.51.100.2", "203.0.113.5"},
+		{"trusted proxy with X-Real-IP", "10.1.2.3:80", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy with X-Forwarded-For", "192.168.1.10:80", "", "198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"spoofed leftmost X-Forwarded-For", "10.1.2.3:80", "", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"trusted proxy without headers", "10.1.2.3:80", "", "", "10.1.2.3"},
+		{"invalid X-Real-IP", "10.1.2.3:80", "not-an-ip", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"bogus"}); err == nil {
+		t.Error("expected an error for an invalid entry")
+	}
+}
+
+func TestTrustedProxiesIsHTTPS(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		want       bool
+	}{
+		{"trusted proxy with https", "10.1.2.3:80", "https", true},
+		{"trusted proxy with http", "10.1.2.3:80", "http", false},
+		{"direct client spoofing https", "203.0.113.5:1234", "https", false},
+		{"direct client without header", "203.0.113.5:1234", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := proxies.IsHTTPS(r); got != tt.want {
+				t.Errorf("IsHTTPS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
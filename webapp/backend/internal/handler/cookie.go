@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Secure属性の付与方針
+type SecureMode int
+
+const (
+	// HTTPS経由のリクエスト(信頼するプロキシのX-Forwarded-Protoを含む)の場合のみ付与する
+	SecureAuto SecureMode = iota
+	SecureAlways
+	SecureNever
+)
+
+// Cookieに付与する属性の設定
+type CookieConfig struct {
+	Secure   SecureMode
+	SameSite http.SameSite
+	Domain   string
+}
+
+func DefaultCookieConfig() CookieConfig {
+	return CookieConfig{
+		Secure:   SecureAuto,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func ParseSecureMode(s string) (SecureMode, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return SecureAuto, nil
+	case "true", "always":
+		return SecureAlways, nil
+	case "false", "never":
+		return SecureNever, nil
+	}
+	return SecureAuto, fmt.Errorf("invalid cookie secure mode: %q", s)
+}
+
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, fmt.Errorf("invalid cookie samesite: %q", s)
+}
+
+// 設定に従ってCookieを生成する (httpsはリクエストをHTTPSで受けたか)
+func (c CookieConfig) newCookie(https bool, name, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Expires:  expires,
+		Path:     "/",
+		Domain:   c.Domain,
+		HttpOnly: httpOnly,
+		Secure:   c.isSecure(https),
+		SameSite: c.SameSite,
+	}
+}
+
+func (c CookieConfig) isSecure(https bool) bool {
+	switch c.Secure {
+	case SecureAlways:
+		return true
+	case SecureNever:
+		return false
+	}
+	// SameSite=NoneはSecure属性が必須
+	if c.SameSite == http.SameSiteNoneMode {
+		return true
+	}
+	return https
+}
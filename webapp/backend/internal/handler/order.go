@@ -1,33 +1,50 @@
 package handler
 
 import (
+	"backend/internal/apierror"
+	"backend/internal/logging"
 	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"io"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// SSEの接続がプロキシに切られないよう、コメントを送る間隔
+const streamKeepAlive = 15 * time.Second
+
+// ダウンロード中、この時間書き込めなければ中断する
+// 読み取りの遅いクライアントがDBの接続を持ち続けないようにする
+const exportWriteTimeout = 30 * time.Second
+
 type OrderHandler struct {
 	OrderSvc *service.OrderService
+
+	// 閉じるとSSEの配信とダウンロードを終える (シャットダウン時)
+	streamsDone chan struct{}
+	closeOnce   sync.Once
 }
 
 func NewOrderHandler(svc *service.OrderService) *OrderHandler {
-	return &OrderHandler{OrderSvc: svc}
+	return &OrderHandler{OrderSvc: svc, streamsDone: make(chan struct{})}
 }
 
 // 注文履歴一覧を取得
 func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User not found", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized", nil)
 		return
 	}
 
 	var req model.ListRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.InvalidBody(w, err)
 		return
 	}
 
@@ -38,22 +55,13 @@ func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
 	if req.PageSize <= 0 {
 		req.PageSize = 20
 	}
-	if req.SortField == "" {
-		req.SortField = "order_id"
-	}
-	if req.SortOrder == "" {
-		req.SortOrder = "desc"
-	}
-	if req.Type != "" && req.Type != "partial" && req.Type != "prefix" {
-		req.Type = "partial"
-	}
+	setOrderListDefaults(&req)
 	// ページネーション用のオフセットを計算
 	req.Offset = (req.Page - 1) * req.PageSize
 
 	orders, total, err := h.OrderSvc.FetchOrders(r.Context(), userID, req)
 	if err != nil {
-		log.Printf("Failed to fetch orders for user %d: %v", userID, err)
-		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		apierror.WriteError(w, r, err)
 		return
 	}
 
@@ -68,3 +76,166 @@ func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// 注文履歴をすべてCSVまたはNDJSONでダウンロードする
+// 検索・ソートの条件はListと同じで、DBから読みながら書き出す
+func (h *OrderHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized", nil)
+		return
+	}
+
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		apierror.InvalidRequest(w, "format must be csv or ndjson")
+		return
+	}
+	req := model.ListRequest{
+		Search:    q.Get("search"),
+		Type:      q.Get("type"),
+		SortField: q.Get("sort_field"),
+		SortOrder: q.Get("sort_order"),
+	}
+	setOrderListDefaults(&req)
+
+	// シャットダウン時はSSEと同様に中断する (途中で切れたダウンロードはクライアントがやり直す)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.streamsDone:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	rc := http.NewResponseController(w)
+	// Keep-Aliveで続くリクエストに期限が残らないよう戻す
+	defer rc.SetWriteDeadline(time.Time{})
+	out := &deadlineWriter{w: w, rc: rc, timeout: exportWriteTimeout}
+
+	var enc orderEncoder
+	if format == "csv" {
+		enc = newCSVOrderEncoder(out)
+	} else {
+		enc = newNDJSONOrderEncoder(out)
+	}
+
+	// 最初の行を読むまでヘッダーを送らず、それまでのエラーは通常のエラーレスポンスで返す
+	started := false
+	start := func() error {
+		started = true
+		header := w.Header()
+		header.Set("Content-Type", enc.contentType())
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="orders-%s.%s"`, time.Now().Format("20060102"), format))
+		header.Set("Cache-Control", "no-store")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		return enc.begin()
+	}
+	err := h.OrderSvc.ExportOrders(ctx, userID, req, func(o model.Order) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return enc.encode(o)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = enc.end()
+	}
+	if err == nil {
+		return
+	}
+	if !started {
+		apierror.WriteError(w, r, err)
+		return
+	}
+	// 途中まで送ったファイルが完全なものに見えないよう、接続を切る
+	logging.Warn(r.Context(), "order export aborted", "format", format, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+// 一覧・ダウンロードで共通のデフォルト値を設定する
+func setOrderListDefaults(req *model.ListRequest) {
+	if req.SortField == "" {
+		req.SortField = "order_id"
+	}
+	if req.SortOrder == "" {
+		req.SortOrder = "desc"
+	}
+	if req.Type != "" && req.Type != "partial" && req.Type != "prefix" {
+		req.Type = "partial"
+	}
+}
+
+// 注文ステータスの変更をServer-Sent Eventsで配信する
+// ブラウザのEventSourceが再接続時に送るLast-Event-ID以降のイベントから再開する
+func (h *OrderHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized", nil)
+		return
+	}
+
+	events, err := h.OrderSvc.StreamStatus(r.Context(), userID, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// nginxでバッファリングしない
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.streamsDone:
+			return
+		case <-ticker.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			err = writeOrderEvent(w, e)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// 配信中のSSEとダウンロードを終える (SSEのクライアントは再接続し、Last-Event-IDから再開する)
+func (h *OrderHandler) CloseStreams() {
+	h.closeOnce.Do(func() { close(h.streamsDone) })
+}
+
+func writeOrderEvent(w io.Writer, e model.OrderEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: order_status\ndata: %s\n\n", e.ID, data)
+	return err
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ダウンロードする注文履歴の1行 (CSVの列も同じ順序)
+type exportedOrder struct {
+	OrderID       int64      `json:"order_id"`
+	ProductID     int        `json:"product_id"`
+	ProductName   string     `json:"product_name"`
+	ShippedStatus string     `json:"shipped_status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ArrivedAt     *time.Time `json:"arrived_at"`
+}
+
+var exportedOrderColumns = []string{"order_id", "product_id", "product_name", "shipped_status", "created_at", "arrived_at"}
+
+func newExportedOrder(o model.Order) exportedOrder {
+	e := exportedOrder{
+		OrderID:       o.OrderID,
+		ProductID:     o.ProductID,
+		ProductName:   o.ProductName,
+		ShippedStatus: o.ShippedStatus,
+		CreatedAt:     o.CreatedAt,
+	}
+	if o.ArrivedAt.Valid {
+		e.ArrivedAt = &o.ArrivedAt.Time
+	}
+	return e
+}
+
+// 注文履歴を1行ずつ書き出す
+type orderEncoder interface {
+	contentType() string
+	begin() error
+	encode(o model.Order) error
+	end() error
+}
+
+// 1行目に列名を書き、日時はRFC 3339 (未配達のarrived_atは空)
+type csvOrderEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVOrderEncoder(w io.Writer) *csvOrderEncoder {
+	return &csvOrderEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvOrderEncoder) contentType() string { return "text/csv; charset=utf-8" }
+
+func (e *csvOrderEncoder) begin() error {
+	return e.w.Write(exportedOrderColumns)
+}
+
+func (e *csvOrderEncoder) encode(o model.Order) error {
+	row := newExportedOrder(o)
+	var arrivedAt string
+	if row.ArrivedAt != nil {
+		arrivedAt = row.ArrivedAt.Format(time.RFC3339)
+	}
+	return e.w.Write([]string{
+		strconv.FormatInt(row.OrderID, 10),
+		strconv.Itoa(row.ProductID),
+		row.ProductName,
+		row.ShippedStatus,
+		row.CreatedAt.Format(time.RFC3339),
+		arrivedAt,
+	})
+}
+
+func (e *csvOrderEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// 1行に1件のJSON (未配達のarrived_atはnull)
+type ndjsonOrderEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONOrderEncoder(w io.Writer) *ndjsonOrderEncoder {
+	return &ndjsonOrderEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *ndjsonOrderEncoder) contentType() string { return "application/x-ndjson" }
+
+func (e *ndjsonOrderEncoder) begin() error { return nil }
+
+func (e *ndjsonOrderEncoder) encode(o model.Order) error {
+	return e.enc.Encode(newExportedOrder(o))
+}
+
+func (e *ndjsonOrderEncoder) end() error { return nil }
+
+// 書き込むたびに書き込みの期限を延ばす
+// ResponseWriterがSetWriteDeadlineに対応していない場合は期限を設けない
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if err := d.rc.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return d.w.Write(p)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SetWriteDeadlineで設定された期限を記録する
+// 最初の書き込みでonFirstWriteを呼ぶ
+type exportRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines    []time.Time
+	writes       int
+	onFirstWrite func()
+}
+
+func (w *exportRecorder) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes == 1 && w.onFirstWrite != nil {
+		w.onFirstWrite()
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func (w *exportRecorder) SetWriteDeadline(t time.Time) error {
+	w.deadlines = append(w.deadlines, t)
+	return nil
+}
+
+func newExportTest(t *testing.T, orders int) (*OrderHandler, http.Handler, string) {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryStore(repository.NewMemoryDB())
+	userID, err := store.UserRepo.Create(ctx, &model.User{UserName: "user", PasswordHash: "x", Role: model.RoleCustomer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, _, err := store.SessionRepo.Create(ctx, userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	productID, err := store.ProductRepo.Create(ctx, model.ProductInput{Name: "商品", Value: 100, Weight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]model.Order, orders)
+	for i := range items {
+		items[i] = model.Order{UserID: userID, ProductID: productID}
+	}
+	if _, err := store.OrderRepo.CreateBulk(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+	h := NewOrderHandler(service.NewOrderService(store))
+	return h, middleware.UserAuthMiddleware(store.SessionRepo)(http.HandlerFunc(h.Export)), sessionID
+}
+
+func newExportRequest(sessionID string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/v1/orders/export?format=csv", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	return req
+}
+
+func TestOrderExportWriteDeadline(t *testing.T) {
+	_, handler, sessionID := newExportTest(t, 500)
+	rec := &exportRecorder{ResponseRecorder: httptest.NewRecorder()}
+	start := time.Now()
+	handler.ServeHTTP(rec, newExportRequest(sessionID))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200\n%s", rec.Code, rec.Body.String())
+	}
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 501 {
+		t.Errorf("lines = %d, want 501", lines)
+	}
+	// 書き込むたびに期限を延ばし、最後に期限をなくす
+	if len(rec.deadlines) < 2 {
+		t.Fatalf("deadlines = %v, want one per write and a final reset", rec.deadlines)
+	}
+	for _, d := range rec.deadlines[:len(rec.deadlines)-1] {
+		if d.Before(start.Add(exportWriteTimeout)) || d.After(time.Now().Add(exportWriteTimeout)) {
+			t.Errorf("deadline = %v, want about %v after each write", d, exportWriteTimeout)
+		}
+	}
+	if last := rec.deadlines[len(rec.deadlines)-1]; !last.IsZero() {
+		t.Errorf("final deadline = %v, want zero", last)
+	}
+}
+
+// シャットダウンが始まったら書き出しを中断し、接続を切る
+func TestOrderExportAbortsOnShutdown(t *testing.T) {
+	h, handler, sessionID := newExportTest(t, 2000)
+	rec := &exportRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec.onFirstWrite = func() {
+		h.CloseStreams()
+		// キャンセルが伝わるのを待つ
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("panic = %v, want http.ErrAbortHandler", p)
+		}
+		if lines := strings.Count(rec.Body.String(), "\n"); lines >= 2001 {
+			t.Errorf("lines = %d, want the export to stop early", lines)
+		}
+	}()
+	handler.ServeHTTP(rec, newExportRequest(sessionID))
+}
@@ -1,37 +1,35 @@
 package handler
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
 )
 
 type ProductHandler struct {
 	ProductSvc *service.ProductService
+	ImageSvc   *service.ImageService
 }
 
-func NewProductHandler(svc *service.ProductService) *ProductHandler {
-	return &ProductHandler{ProductSvc: svc}
+func NewProductHandler(svc *service.ProductService, imageSvc *service.ImageService) *ProductHandler {
+	return &ProductHandler{ProductSvc: svc, ImageSvc: imageSvc}
 }
 
 // 商品一覧を取得
 func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized", nil)
 		return
 	}
 
 	var req model.ListRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.InvalidBody(w, err)
 		return
 	}
 
@@ -51,8 +49,7 @@ func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	products, total, err := h.ProductSvc.FetchProducts(r.Context(), userID, req)
 	if err != nil {
-		log.Printf("Failed to fetch products for user %d: %v", userID, err)
-		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		apierror.WriteError(w, r, err)
 		return
 	}
 
@@ -72,20 +69,19 @@ func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized", nil)
 		return
 	}
 
 	var req model.CreateOrderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.InvalidBody(w, err)
 		return
 	}
 
 	insertedOrderIDs, err := h.ProductSvc.CreateOrders(r.Context(), userID, req.Items)
 	if err != nil {
-		log.Printf("Failed to create orders: %v", err)
-		http.Error(w, "Failed to process order request", http.StatusInternalServerError)
+		apierror.WriteError(w, r, err)
 		return
 	}
 
@@ -98,53 +94,40 @@ func (h *ProductHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// 商品画像を配信する
+// ?w= を指定するとリサイズ版を返す。Range・条件付きリクエストはhttp.ServeContentで処理する
 func (h *ProductHandler) GetImage(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("画像リクエスト受信: %s\n", r.URL.String())
 	imagePath := r.URL.Query().Get("path")
 	if imagePath == "" {
-		fmt.Println("画像パスが空です")
-		http.Error(w, "画像パスが指定されていません", http.StatusBadRequest)
+		apierror.InvalidRequest(w, "query parameter 'path' is required")
 		return
 	}
 
-	imagePath = filepath.Clean(imagePath)
-	if filepath.IsAbs(imagePath) || strings.Contains(imagePath, "..") {
-		fmt.Printf("無効なパス: %s\n", imagePath)
-		http.Error(w, "無効なパスです", http.StatusBadRequest)
-		return
-	}
-
-	baseImageDir := "/app/images"
-	fullPath := filepath.Join(baseImageDir, imagePath)
-
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		fmt.Printf("画像ファイルが見つかりません: %s\n", fullPath)
-		http.Error(w, "画像が見つかりません", http.StatusNotFound)
-		return
-	}
-
-	ext := filepath.Ext(fullPath)
-	var contentType string
-	switch strings.ToLower(ext) {
-	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
-	case ".png":
-		contentType = "image/png"
-	case ".gif":
-		contentType = "image/gif"
-	case ".webp":
-		contentType = "image/webp"
-	default:
-		contentType = "application/octet-stream"
+	width := 0
+	if ws := r.URL.Query().Get("w"); ws != "" {
+		var err error
+		width, err = strconv.Atoi(ws)
+		if err != nil || width <= 0 {
+			apierror.InvalidRequest(w, "query parameter 'w' must be a positive integer")
+			return
+		}
 	}
-	w.Header().Set("Content-Type", contentType)
 
-	data, err := os.ReadFile(fullPath)
+	img, err := h.ImageSvc.Open(r.Context(), imagePath, width)
 	if err != nil {
-		fmt.Printf("画像ファイルの読み込みに失敗: %s\n", fullPath)
-		http.Error(w, "画像の読み込みに失敗しました", http.StatusInternalServerError)
+		apierror.WriteError(w, r, err)
 		return
 	}
+	defer img.Close()
 
-	w.Write(data)
+	header := w.Header()
+	header.Set("Content-Type", img.ContentType)
+	header.Set("ETag", img.ETag)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if img.Immutable {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "public, max-age=3600")
+	}
+	http.ServeContent(w, r, "", img.ModTime, img)
 }
@@ -1,10 +1,11 @@
 package handler
 
 import (
+	"backend/internal/apierror"
+	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 )
@@ -19,23 +20,26 @@ func NewRobotHandler(robotSvc *service.RobotService) *RobotHandler {
 
 // 配送計画を取得
 func (h *RobotHandler) GetDeliveryPlan(w http.ResponseWriter, r *http.Request) {
-	robotID := "robot-001"
+	robotID, ok := middleware.GetRobotFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "invalid or missing API key", nil)
+		return
+	}
 
 	capacityStr := r.URL.Query().Get("capacity")
 	if capacityStr == "" {
-		http.Error(w, "Query parameter 'capacity' is required", http.StatusBadRequest)
+		apierror.InvalidRequest(w, "query parameter 'capacity' is required")
 		return
 	}
 	capacity, err := strconv.Atoi(capacityStr)
 	if err != nil {
-		http.Error(w, "Query parameter 'capacity' must be an integer", http.StatusBadRequest)
+		apierror.InvalidRequest(w, "query parameter 'capacity' must be an integer")
 		return
 	}
 
 	plan, err := h.RobotSvc.GenerateDeliveryPlan(r.Context(), robotID, capacity)
 	if err != nil {
-		log.Printf("Failed to generate delivery plan: %v", err)
-		http.Error(w, "Failed to create delivery plan", http.StatusInternalServerError)
+		apierror.WriteError(w, r, err)
 		return
 	}
 
@@ -47,14 +51,13 @@ func (h *RobotHandler) GetDeliveryPlan(w http.ResponseWriter, r *http.Request) {
 func (h *RobotHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	var req model.UpdateOrderStatusRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.InvalidBody(w, err)
 		return
 	}
 
 	err := h.RobotSvc.UpdateOrderStatus(r.Context(), req.OrderID, req.NewStatus)
 	if err != nil {
-		log.Printf("Failed to update order status for order %d: %v", req.OrderID, err)
-		http.Error(w, "Failed to update order status", http.StatusInternalServerError)
+		apierror.WriteError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,162 @@
+// 依存サービス(MySQL, Redis)の状態を確認し、readinessを判定する
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusFail     Status = "fail"
+)
+
+type ComponentResult struct {
+	Status    Status         `json:"status"`
+	LatencyMS float64        `json:"latency_ms"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status     Status                     `json:"status"`
+	Components map[string]ComponentResult `json:"components"`
+}
+
+// コネクションプールの使用率がこれを超えたらdegradedとする
+const poolDegradedRatio = 0.8
+
+type Checker struct {
+	db      *sqlx.DB
+	rdb     *redis.Client
+	timeout time.Duration
+	// シャットダウン中はfalseを返す
+	ready func() bool
+
+	mu            sync.Mutex
+	lastWaitCount int64
+}
+
+func NewChecker(db *sqlx.DB, rdb *redis.Client, timeout time.Duration, ready func() bool) *Checker {
+	return &Checker{db: db, rdb: rdb, timeout: timeout, ready: ready}
+}
+
+// 各コンポーネントを並行して確認する
+// MySQLとプール枯渇はfail、Redisはキャッシュ用途のためdegradedとして扱う
+func (c *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Components: make(map[string]ComponentResult, 4)}
+	if !c.ready() {
+		report.Components["server"] = ComponentResult{Status: StatusFail, Error: "shutting down"}
+	}
+
+	var (
+		wg          sync.WaitGroup
+		mysqlResult ComponentResult
+		redisResult ComponentResult
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		mysqlResult = measure(func() error { return c.db.PingContext(ctx) }, StatusFail)
+	}()
+	go func() {
+		defer wg.Done()
+		redisResult = measure(func() error { return c.rdb.Ping(ctx).Err() }, StatusDegraded)
+	}()
+	wg.Wait()
+
+	report.Components["mysql"] = mysqlResult
+	report.Components["redis"] = redisResult
+	report.Components["mysql_pool"] = c.checkPool()
+
+	for _, r := range report.Components {
+		if r.Status == StatusFail {
+			report.Status = StatusFail
+			break
+		}
+		if r.Status == StatusDegraded {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func measure(fn func() error, failStatus Status) ComponentResult {
+	start := time.Now()
+	err := fn()
+	result := ComponentResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = failStatus
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// すべてのコネクションが使用中で、前回の確認以降に接続待ちが発生していればfailとする
+func (c *Checker) checkPool() ComponentResult {
+	stats := c.db.Stats()
+	c.mu.Lock()
+	waited := stats.WaitCount > c.lastWaitCount
+	c.lastWaitCount = stats.WaitCount
+	c.mu.Unlock()
+
+	result := ComponentResult{
+		Status: StatusOK,
+		Details: map[string]any{
+			"max_open":      stats.MaxOpenConnections,
+			"open":          stats.OpenConnections,
+			"in_use":        stats.InUse,
+			"idle":          stats.Idle,
+			"wait_count":    stats.WaitCount,
+			"wait_duration": stats.WaitDuration.String(),
+		},
+	}
+	if stats.MaxOpenConnections <= 0 {
+		return result
+	}
+	ratio := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	result.Details["usage_ratio"] = ratio
+	switch {
+	case stats.InUse >= stats.MaxOpenConnections && waited:
+		result.Status = StatusFail
+		result.Error = "connection pool saturated"
+	case ratio >= poolDegradedRatio:
+		result.Status = StatusDegraded
+	}
+	return result
+}
+
+// GET /healthz プロセスが応答できるかだけを返す (依存サービスは確認しない)
+func Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]Status{"status": StatusOK})
+}
+
+// GET /readyz 依存サービスを確認し、failの場合は503を返す (degradedは200)
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,102 @@
+package imagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ローカルファイルシステムに保存するImageStore
+// キーはbaseDirからのスラッシュ区切りの相対パス
+type FileStore struct {
+	baseDir string
+}
+
+func NewFileStore(baseDir string) *FileStore {
+	return &FileStore{baseDir: baseDir}
+}
+
+// baseDirの外を指すキー (".." や絶対パス) は拒否する
+func (s *FileStore) path(key string) (string, error) {
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid image key %q", key)
+	}
+	return filepath.Join(s.baseDir, rel), nil
+}
+
+func (s *FileStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, ErrNotExist
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, ObjectInfo{}, mapFileError(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, ObjectInfo{}, ErrNotExist
+	}
+	return f, ObjectInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *FileStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, ErrNotExist
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return ObjectInfo{}, mapFileError(err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, ErrNotExist
+	}
+	return ObjectInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// 一時ファイルに書き込んでからリネームし、途中までの書き込みが見えないようにする
+func (s *FileStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	return nil
+}
+
+func mapFileError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package imagestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStorePutOpenStat(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(t.TempDir())
+
+	if err := s.Put(ctx, "products/cache/a.png", []byte("first"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	// 上書きできる
+	if err := s.Put(ctx, "products/cache/a.png", []byte("second"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Stat(ctx, "products/cache/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len("second")) || info.ModTime.IsZero() {
+		t.Errorf("Stat() = %+v", info)
+	}
+
+	f, info, err := s.Open(ctx, "products/cache/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" || info.Size != int64(len(data)) {
+		t.Errorf("Open() = %q, %+v", data, info)
+	}
+
+	// 一時ファイルが残っていない
+	entries, err := os.ReadDir(filepath.Join(s.baseDir, "products", "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want 1", len(entries))
+	}
+}
+
+func TestFileStoreNotExist(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(t.TempDir())
+	if err := s.Put(ctx, "products/a.png", []byte("x"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	// ディレクトリも存在しないものとして扱う
+	for _, key := range []string{"missing.png", "products/missing.png", "products"} {
+		if _, err := s.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Stat(%q) = %v, want ErrNotExist", key, err)
+		}
+		if _, _, err := s.Open(ctx, key); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want ErrNotExist", key, err)
+		}
+	}
+}
+
+func TestFileStoreRejectsPathTraversal(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	baseDir := filepath.Join(root, "images")
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewFileStore(baseDir)
+
+	for _, key := range []string{"../secret.txt", "products/../../secret.txt", "/etc/passwd", ""} {
+		if _, err := s.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Stat(%q) = %v, want ErrNotExist", key, err)
+		}
+		if _, _, err := s.Open(ctx, key); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want ErrNotExist", key, err)
+		}
+		if err := s.Put(ctx, key, []byte("overwritten"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "secret.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "secret" {
+		t.Errorf("file outside baseDir was overwritten: %q", data)
+	}
+}
@@ -0,0 +1,138 @@
+package imagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// S3のレスポンスを返すスタブ
+// bucket以外のバケットは存在せず、forbidden/ 以下のキーはAccessDeniedになる
+func newS3Stub(t *testing.T, objects map[string]string) *httptest.Server {
+	t.Helper()
+	writeError := func(w http.ResponseWriter, r *http.Request, status int, code string) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource><RequestId>stub</RequestId></Error>`,
+				code, code, r.URL.Path)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		switch {
+		case bucket != "bucket":
+			writeError(w, r, http.StatusNotFound, "NoSuchBucket")
+		case key == "":
+			w.WriteHeader(http.StatusOK)
+		case strings.HasPrefix(key, "images/forbidden/"):
+			writeError(w, r, http.StatusForbidden, "AccessDenied")
+		case r.Method == http.MethodPut:
+			// 本文はチャンク署名付きで送られるため、Content-Typeだけを記録する
+			objects[key] = r.Header.Get("Content-Type")
+			w.Header().Set("ETag", `"stub"`)
+			w.WriteHeader(http.StatusOK)
+		default:
+			body, ok := objects[key]
+			if !ok {
+				writeError(w, r, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 00:00:00 GMT")
+			w.Header().Set("ETag", `"stub"`)
+			w.WriteHeader(http.StatusOK)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, body)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestS3Store(t *testing.T, objects map[string]string, bucket string) (*S3Store, error) {
+	t.Helper()
+	srv := newS3Stub(t, objects)
+	return NewS3Store(context.Background(), S3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Bucket:    bucket,
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+		Prefix:    "images",
+	})
+}
+
+func TestS3StoreMapsErrors(t *testing.T) {
+	ctx := context.Background()
+	objects := map[string]string{"images/a.png": "png"}
+	s, err := newTestS3Store(t, objects, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Stat(ctx, "a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 3 || info.ModTime.IsZero() {
+		t.Errorf("Stat() = %+v", info)
+	}
+
+	if _, err := s.Stat(ctx, "missing.png"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat(missing) = %v, want ErrNotExist", err)
+	}
+	if _, _, err := s.Open(ctx, "missing.png"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Open(missing) = %v, want ErrNotExist", err)
+	}
+
+	// 権限エラーは存在しないものとして扱わない
+	if _, err := s.Stat(ctx, "forbidden/a.png"); err == nil || errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat(forbidden) = %v, want an error other than ErrNotExist", err)
+	}
+	if _, _, err := s.Open(ctx, "forbidden/a.png"); err == nil || errors.Is(err, ErrNotExist) {
+		t.Errorf("Open(forbidden) = %v, want an error other than ErrNotExist", err)
+	}
+}
+
+func TestS3StorePutOpen(t *testing.T) {
+	ctx := context.Background()
+	objects := map[string]string{}
+	s, err := newTestS3Store(t, objects, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(ctx, "products/a.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if objects["images/products/a.png"] != "image/png" {
+		t.Fatalf("objects = %v", objects)
+	}
+
+	objects["images/products/b.png"] = "png"
+	f, info, err := s.Open(ctx, "products/b.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "png" || info.Size != 3 {
+		t.Errorf("Open() = %q, %+v", data, info)
+	}
+}
+
+func TestNewS3StoreRequiresBucket(t *testing.T) {
+	if _, err := newTestS3Store(t, map[string]string{}, "missing"); err == nil {
+		t.Error("NewS3Store succeeded for a bucket that does not exist")
+	}
+}
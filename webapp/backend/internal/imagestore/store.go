@@ -0,0 +1,26 @@
+// 商品画像の保存先を抽象化する
+// ローカルファイルシステムとS3互換ストレージ(AWS S3, MinIOなど)を切り替えられる
+package imagestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotExist = errors.New("image object does not exist")
+
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+type ImageStore interface {
+	// オブジェクトを読み込み用に開く (存在しない場合はErrNotExist)
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error)
+	// オブジェクトの情報を取得する (存在しない場合はErrNotExist)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// オブジェクトを書き込む (既にある場合は上書き)
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+}
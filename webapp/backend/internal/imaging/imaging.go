@@ -0,0 +1,125 @@
+// 画像の形式判定・リサイズ・エンコードを行う (cgoに依存しない)
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// 対応する画像形式
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+)
+
+// デコードを許可する最大ピクセル数 (巨大画像によるメモリ枯渇を防ぐ)
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions too large")
+)
+
+// 先頭バイトから画像形式を判定する (拡張子やContent-Typeは信用しない)
+func Sniff(data []byte) (string, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return FormatJPEG, nil
+	case "image/png":
+		return FormatPNG, nil
+	case "image/gif":
+		return FormatGIF, nil
+	case "image/webp":
+		return FormatWebP, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// 画像形式に対応する拡張子
+func Extension(format string) string {
+	if format == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// 画像形式に対応するContent-Type
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// 形式を判定した上でデコードする
+// ヘッダーのサイズを先に確認し、MaxPixelsを超える場合はデコードしない
+func Decode(data []byte) (image.Image, string, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if decodedFormat != format {
+		return nil, "", fmt.Errorf("%w: content is %s but decoded as %s", ErrUnsupportedFormat, format, decodedFormat)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	return img, format, nil
+}
+
+// 縦横比を保ったまま指定した幅に縮小する
+// 元画像の幅以下の場合はそのまま返す
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if width <= 0 || b.Dx() <= width {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// 指定した形式でエンコードする
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatGIF:
+		return gif.Encode(w, img, nil)
+	case FormatWebP:
+		return nativewebp.Encode(w, img, nil)
+	}
+	return ErrUnsupportedFormat
+}
+
+// サムネイルの形式 (透過を保つためJPEG以外はPNGにする)
+func ThumbnailFormat(original string) string {
+	if original == FormatJPEG {
+		return FormatJPEG
+	}
+	return FormatPNG
+}
@@ -0,0 +1,206 @@
+// log/slogによる構造化ログ
+// リクエストごとのロガー(リクエストID・ユーザーID等を付与済み)をcontextで受け渡し、
+// 出力時にトレースID・スパンIDを付与する
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redacted = "***"
+
+// 値を伏せる属性名 (小文字で部分一致)
+var secretKeys = []string{
+	"password", "passwd", "secret", "token", "api_key", "apikey",
+	"authorization", "cookie", "session_id", "dsn",
+}
+
+type ctxKey struct{}
+
+// ログレベルと出力形式(json / text)からロガーを作り、slogとlogパッケージの既定にする
+// extraにはOpenTelemetryのログブリッジなど、標準出力以外の出力先を渡す
+func Setup(level, format string, extra ...slog.Handler) (*slog.Logger, error) {
+	logger, err := New(os.Stdout, level, format, extra...)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+func New(w io.Writer, level, format string, extra ...slog.Handler) (*slog.Logger, error) {
+	var lv slog.Level
+	if err := lv.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lv}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json", "":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be json or text", format)
+	}
+	if len(extra) > 0 {
+		handlers := []slog.Handler{h}
+		for _, e := range extra {
+			handlers = append(handlers, &levelHandler{Handler: e, level: lv})
+		}
+		h = fanoutHandler(handlers)
+	}
+	return slog.New(&traceHandler{Handler: h}), nil
+}
+
+// 秘密情報と思われる属性の値を伏せる (グループ内も対象)
+func redact(a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		attrs := make([]any, len(group))
+		for i, g := range group {
+			attrs[i] = redact(g)
+		}
+		return slog.Group(a.Key, attrs...)
+	}
+	return a
+}
+
+func redactAll(attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = redact(a)
+	}
+	return out
+}
+
+// 出力時にcontextのスパンからtrace_id / span_idを付与し、秘密情報を伏せる
+// どの出力先にも伏せた後の値が渡るよう、ReplaceAttrではなくここで処理する
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redact(a))
+		return true
+	})
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		out.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithAttrs(redactAll(attrs))}
+}
+
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// 複数の出力先に同じレコードを渡す
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// 設定したログレベル未満を捨てる (OpenTelemetryのブリッジはレベルを持たないため)
+type levelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// contextに保存されたロガーを返す。なければ既定のロガー
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// 属性を追加したロガーをcontextに保存する (例: With(ctx, "user_id", 1))
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, ctxKey{}, FromContext(ctx).With(args...))
+}
+
+func Debug(ctx context.Context, msg string, args ...any) {
+	FromContext(ctx).DebugContext(ctx, msg, args...)
+}
+
+func Info(ctx context.Context, msg string, args ...any) {
+	FromContext(ctx).InfoContext(ctx, msg, args...)
+}
+
+func Warn(ctx context.Context, msg string, args ...any) {
+	FromContext(ctx).WarnContext(ctx, msg, args...)
+}
+
+func Error(ctx context.Context, msg string, args ...any) {
+	FromContext(ctx).ErrorContext(ctx, msg, args...)
+}
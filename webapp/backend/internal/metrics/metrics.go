@@ -0,0 +1,189 @@
+// Prometheus形式のメトリクスを定義し、/metricsで公開する
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "backend"
+
+// ルートに一致しなかったリクエストのラベル (パスをそのまま使うとラベルが無限に増えるため)
+const unmatchedRoute = "unmatched"
+
+// グローバルなDefaultRegistererは使わず、このパッケージで登録したものだけを公開する
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by chi route pattern.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Redis cache lookups by cache name and result (hit, miss, error).",
+	}, []string{"cache", "result"})
+
+	timeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "timeouts_total",
+		Help:      "Operations aborted by a deadline, by the utils.RunStage stage that was running.",
+	}, []string{"stage"})
+
+	replicaReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_replica_reads_total",
+		Help:      "Read queries eligible for the replica by where they ran (replica, primary_lag, primary_error).",
+	}, []string{"target"})
+
+	replicaLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_replica_lag_seconds",
+		Help:      "Replication lag of the read replica; -1 when it is unreachable or replication is stopped.",
+	})
+
+	outboxEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_events_total",
+		Help:      "Outbox events handed to the sink by result (published, failed, abandoned).",
+	}, []string{"sink", "result"})
+
+	outboxLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "outbox_lag_seconds",
+		Help:      "Age of the oldest outbox event in the last batch the relay published.",
+	})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook send attempts by result (delivered, retry, dead_letter).",
+	}, []string{"result"})
+
+	solverDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_plan_solver_duration_seconds",
+		Help:      "Time spent solving the delivery-plan knapsack.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2},
+	})
+
+	solverCandidateOrders = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_plan_candidate_orders",
+		Help:      "Number of shipping orders considered by the delivery-plan solver.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	solverChosenOrders = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_plan_chosen_orders",
+		Help:      "Number of orders chosen for a delivery plan.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		httpRequestsInFlight,
+		cacheRequests,
+		timeouts,
+		replicaReads,
+		replicaLag,
+		outboxEvents,
+		outboxLag,
+		webhookDeliveries,
+		solverDuration,
+		solverCandidateOrders,
+		solverChosenOrders,
+	)
+}
+
+// GET /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// コネクションプールの統計(sql.DB.Stats)をスクレイプ時に取得するよう登録する
+func RegisterDBStats(db *sql.DB, dbName string) error {
+	return registry.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// リクエストのレイテンシをchiのルートパターンごとに記録する
+// ルートパターンはルーティング後に確定するため、次のハンドラーの処理後に取得する
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if p := rctx.RoutePattern(); p != "" {
+				route = p
+			}
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequestDuration.
+			WithLabelValues(r.Method, route, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// Redisキャッシュの参照結果を記録する
+func CacheHit(cache string)   { cacheRequests.WithLabelValues(cache, "hit").Inc() }
+func CacheMiss(cache string)  { cacheRequests.WithLabelValues(cache, "miss").Inc() }
+func CacheError(cache string) { cacheRequests.WithLabelValues(cache, "error").Inc() }
+
+// utils.RunStageでタイムアウトした回数を段階ごとに記録する
+func Timeout(stage string) { timeouts.WithLabelValues(stage).Inc() }
+
+// レプリカ向けの読み取りをどこで実行したかを記録する
+func ReplicaRead(target string) { replicaReads.WithLabelValues(target).Inc() }
+
+// レプリカの遅延を記録する (不明な場合は負の値)
+func SetReplicaLag(seconds float64) { replicaLag.Set(seconds) }
+
+// outboxのイベントを配信した結果(published, failed, abandoned)ごとの件数を記録する
+func OutboxEvents(sink, result string, n int) {
+	outboxEvents.WithLabelValues(sink, result).Add(float64(n))
+}
+
+// 配信したイベントが記録されてから配信されるまでの時間を記録する
+func SetOutboxLag(d time.Duration) { outboxLag.Set(d.Seconds()) }
+
+// Webhookの送信結果を記録する
+func WebhookDeliveries(result string) { webhookDeliveries.WithLabelValues(result).Inc() }
+
+// 配送計画の計算時間と、候補・選択された注文数を記録する
+func ObserveSolver(d time.Duration, candidates, chosen int) {
+	solverDuration.Observe(d.Seconds())
+	solverCandidateOrders.Observe(float64(candidates))
+	solverChosenOrders.Observe(float64(chosen))
+}
@@ -2,50 +2,83 @@ package middleware
 
 import (
 	"context"
-	"log"
 	"net/http"
 
+	"backend/internal/apierror"
+	"backend/internal/logging"
 	"backend/internal/repository"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey  contextKey = "user"
+	roleContextKey  contextKey = "role"
+	robotContextKey contextKey = "robot"
+)
+
+// APIキーに対応するロボット (現状はキーが1つのため1台のみ)
+const DefaultRobotID = "robot-001"
 
-func UserAuthMiddleware(sessionRepo *repository.SessionRepository) func(http.Handler) http.Handler {
+func UserAuthMiddleware(sessionRepo repository.Sessions) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			cookie, err := r.Cookie("session_id")
 			if err != nil {
-				log.Printf("Error retrieving session cookie: %v", err)
-				http.Error(w, "Unauthorized: No session cookie", http.StatusUnauthorized)
+				logging.Info(r.Context(), "session cookie not found", "error", err)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "no session cookie", nil)
 				return
 			}
 			sessionID := cookie.Value
 
-			userID, err := sessionRepo.FindUserBySessionID(r.Context(), sessionID)
+			user, err := sessionRepo.FindUserBySessionID(r.Context(), sessionID)
 			if err != nil {
-				log.Printf("Error finding user by session ID: %v", err)
-				http.Error(w, "Unauthorized: Invalid session", http.StatusUnauthorized)
+				logging.Info(r.Context(), "invalid session", "error", err)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "invalid session", nil)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), userContextKey, userID)
+			ctx := context.WithValue(r.Context(), userContextKey, user.UserID)
+			ctx = context.WithValue(ctx, roleContextKey, user.Role)
+			ctx = logging.With(ctx, "user_id", user.UserID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// 指定したロールのいずれかを持つユーザーのみ通過させる
+// UserAuthMiddlewareの後に適用すること
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := GetRoleFromContext(r.Context())
+			if !ok {
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized", nil)
+				return
+			}
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "insufficient role", nil)
+		})
+	}
+}
+
 func RobotAuthMiddleware(validAPIKey string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			apiKey := r.Header.Get("X-API-KEY")
 
 			if apiKey == "" || apiKey != validAPIKey {
-				http.Error(w, "Forbidden: Invalid or missing API key", http.StatusForbidden)
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "invalid or missing API key", nil)
 				return
 			}
-			next.ServeHTTP(w, r)
+			ctx := context.WithValue(r.Context(), robotContextKey, DefaultRobotID)
+			ctx = logging.With(ctx, "robot_id", DefaultRobotID)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
@@ -56,3 +89,16 @@ func GetUserFromContext(ctx context.Context) (int, bool) {
 	userID, ok := ctx.Value(userContextKey).(int)
 	return userID, ok
 }
+
+// コンテキストからロボットIDを取得
+// ロボットIDはRobotAuthMiddlewareで設定される
+func GetRobotFromContext(ctx context.Context) (string, bool) {
+	robotID, ok := ctx.Value(robotContextKey).(string)
+	return robotID, ok
+}
+
+// コンテキストからユーザーのロールを取得
+func GetRoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roleContextKey).(string)
+	return role, ok
+}
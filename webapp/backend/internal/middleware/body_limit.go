@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"backend/internal/apierror"
+)
+
+// JSON APIのリクエストボディの上限 (設定で変更できる)
+const DefaultMaxBodyBytes = 1 << 20
+
+// リクエストボディのサイズを制限する
+// Content-Lengthで上限を超えると分かる場合はすぐに413を返し、
+// それ以外は読み込み時にhttp.MaxBytesErrorになる
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				apierror.TooLarge(w, limit)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"backend/internal/apierror"
+)
+
+// Double Submit Cookie方式のCSRF対策
+// フロントエンド(axios)のデフォルト名に合わせている
+const (
+	CSRFCookieName = "XSRF-TOKEN"
+	CSRFHeaderName = "X-XSRF-TOKEN"
+)
+
+// CSRFトークンを生成する
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 状態を変更するリクエストについて、CookieとヘッダーのCSRFトークンが一致するか検証する
+// セッションCookieを持たずロボットAPIキーのみで認証するリクエストは対象外
+func CSRFMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isSafeMethod(r.Method) || isRobotOnlyRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cookie, err := r.Cookie(CSRFCookieName)
+			header := r.Header.Get(CSRFHeaderName)
+			if err != nil || cookie.Value == "" || header == "" ||
+				subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+				apierror.Write(w, http.StatusForbidden, "invalid_csrf_token", "invalid CSRF token", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func isRobotOnlyRequest(r *http.Request) bool {
+	if r.Header.Get("X-API-KEY") == "" {
+		return false
+	}
+	_, err := r.Cookie("session_id")
+	return err != nil
+}
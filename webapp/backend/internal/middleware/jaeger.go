@@ -1,49 +0,0 @@
-package middleware
-
-import (
-	"net/http"
-	"os"
-
-	"context"
-
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-)
-
-func InitJaegerTracer() error {
-	otlpEndpoint := os.Getenv("OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "jaeger:4318"
-	}
-	exp, err := otlptracehttp.New(
-		context.Background(),
-		otlptracehttp.WithEndpoint(otlpEndpoint),
-		otlptracehttp.WithInsecure(),
-	)
-	if err != nil {
-		return err
-	}
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exp),
-		trace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("backend"),
-		)),
-	)
-	otel.SetTracerProvider(tp)
-	return nil
-}
-
-func JaegerMiddleware() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			tracer := otel.Tracer("webapp")
-			ctx, span := tracer.Start(r.Context(), r.URL.Path)
-			defer span.End()
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
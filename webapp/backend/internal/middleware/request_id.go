@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"backend/internal/logging"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDContextKey contextKey = "request_id"
+
+// 受け取ったリクエストIDの最大長 (ログを汚されないよう、長すぎるものは採番し直す)
+const maxRequestIDLength = 64
+
+// リクエストIDを採番(または上流のnginx等から引き継ぎ)し、レスポンスヘッダーとログに付与する
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request_id", id))
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		ctx = logging.With(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// コンテキストからリクエストIDを取得
+func GetRequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
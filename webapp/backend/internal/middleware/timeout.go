@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/internal/apierror"
+	"backend/internal/service/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// クライアントが指定する期限 (ミリ秒の整数、または"500ms"・"2s"のような時間)
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// タイムアウトの設定
+type Timeouts struct {
+	// ルートに個別の設定がない場合のタイムアウト
+	Default time.Duration
+	// "GET /api/robot/delivery-plan"のような、メソッドとchiのルートパターンごとのタイムアウト (0はタイムアウトなし)
+	Routes map[string]time.Duration
+	// utils.RunStageの段階ごとのタイムアウト
+	Stages map[string]time.Duration
+}
+
+// ルートごとのタイムアウトをリクエストのcontextの期限として設定する
+// X-Request-Timeoutヘッダーで、クライアントはルートのタイムアウトより短い期限を指定できる
+// 期限切れ後の処理はcontextのキャンセルで中断され、ハンドラーが504を返す
+func Timeout(routes chi.Routes, cfg Timeouts) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := cfg.Default
+			// ルーティング前なので、ルートパターンはここで照合して求める
+			rctx := chi.NewRouteContext()
+			if routes.Match(rctx, r.Method, r.URL.Path) {
+				if d, ok := cfg.Routes[r.Method+" "+rctx.RoutePattern()]; ok {
+					timeout = d
+				}
+			}
+
+			if v := r.Header.Get(RequestTimeoutHeader); v != "" {
+				d, ok := parseRequestTimeout(v)
+				if !ok {
+					apierror.InvalidRequest(w, "invalid "+RequestTimeoutHeader+" header")
+					return
+				}
+				if timeout <= 0 || d < timeout {
+					timeout = d
+				}
+			}
+
+			ctx := utils.WithStageTimeouts(r.Context(), cfg.Stages)
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func parseRequestTimeout(v string) (time.Duration, bool) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, ms > 0 && ms <= math.MaxInt64/int64(time.Millisecond)
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil && d > 0
+}
@@ -0,0 +1,402 @@
+// スキーマのマイグレーションを適用・記録する
+// マイグレーションはwebapp/mysql/migrationの {番号}_{名前}.sql (down/に同名の戻し用SQL) で、
+// 適用済みのものはschema_migrationsテーブルにチェックサムとともに記録する
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dockerのビルドコンテキストがbackend配下のため、マイグレーションのコピーを埋め込む
+// マイグレーションを追加・変更したら go generate ./internal/migrate で更新すること
+//
+//go:generate sh -c "rm -rf sql && cp -r ../../../mysql/migration sql"
+//go:embed sql
+var files embed.FS
+
+// 複数のプロセスが同時に適用しないよう、GET_LOCKで排他する
+const (
+	lockName    = "schema_migrations"
+	lockTimeout = 30 * time.Second
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	// 戻し用のSQLがない場合は空
+	Down     string
+	Checksum string
+}
+
+// マイグレーションごとの適用状況
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// 適用中に失敗し、手動での修復が必要
+	Dirty bool
+	// 適用後にファイルが変更された
+	Modified bool
+}
+
+// 適用状況が最新ではない場合のエラー
+var ErrNotUpToDate = errors.New("database schema is not up to date")
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func New(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// 埋め込んだSQLファイル (fsysのsql配下) を番号順に読み込む
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		m := fileNamePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %q: %w", e.Name(), err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, e.Name())
+		}
+		seen[version] = e.Name()
+
+		up, err := fs.ReadFile(fsys, path.Join("sql", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		down, err := fs.ReadFile(fsys, path.Join("sql", "down", e.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		sum := sha256.Sum256(up)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     m[2],
+			Up:       string(up),
+			Down:     string(down),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+type appliedRow struct {
+	Version   int       `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	Dirty     bool      `db:"dirty"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+const createTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		dirty BOOLEAN NOT NULL DEFAULT FALSE,
+		applied_at DATETIME NOT NULL
+	)`
+
+// ロックを取得し、schema_migrationsを用意してからfnを実行する
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.GetContext(ctx, &locked, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("failed to acquire migration lock within %s: another migration may be running", lockTimeout)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", lockName)
+
+	if _, err := conn.ExecContext(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// 未適用のマイグレーションを番号順にすべて適用し、適用したものを返す
+// 適用済みのファイルが変更されている場合や、失敗したまま(dirty)のものがある場合は何もしない
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkConsistent(statuses); err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				continue
+			}
+			if err := m.apply(ctx, conn, s.Migration); err != nil {
+				return err
+			}
+			done = append(done, s.Migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// 適用済みのマイグレーションを新しいものからsteps件戻し、戻したものを返す
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive: %d", steps)
+	}
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkConsistent(statuses); err != nil {
+			return err
+		}
+		for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+			s := statuses[i]
+			if !s.Applied {
+				continue
+			}
+			if err := m.revert(ctx, conn, s.Migration); err != nil {
+				return err
+			}
+			done = append(done, s.Migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// version以下のマイグレーションを、SQLを実行せずに適用済みとして記録する
+// restore_and_migration.sh(採点時の処理)のように、ランナーを使わずに適用したスキーマに使う
+func (m *Migrator) Baseline(ctx context.Context, version int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied || s.Version > version {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum, dirty, applied_at) VALUES (?, ?, ?, FALSE, UTC_TIMESTAMP())",
+				s.Version, s.Name, s.Checksum); err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", s.Version, err)
+			}
+			done = append(done, s.Migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// すべてのマイグレーションの適用状況を返す
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	exists, err := m.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return m.merge(nil), nil
+	}
+	return m.status(ctx, m.db)
+}
+
+// 未適用・変更済み・失敗したままのマイグレーションがあればErrNotUpToDateを返す (起動時のチェック用)
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkConsistent(statuses); err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, fmt.Sprintf("%d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s", ErrNotUpToDate, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+func (m *Migrator) tableExists(ctx context.Context) (bool, error) {
+	var n int
+	err := m.db.GetContext(ctx, &n,
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'")
+	if err != nil {
+		return false, fmt.Errorf("failed to check schema_migrations: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (m *Migrator) status(ctx context.Context, q sqlx.QueryerContext) ([]Status, error) {
+	var rows []appliedRow
+	if err := sqlx.SelectContext(ctx, q, &rows,
+		"SELECT version, name, checksum, dirty, applied_at FROM schema_migrations ORDER BY version"); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return m.merge(rows), nil
+}
+
+// ファイルと記録を突き合わせる (ファイルが削除された記録も含める)
+func (m *Migrator) merge(rows []appliedRow) []Status {
+	applied := make(map[int]appliedRow, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = r.AppliedAt
+			s.Dirty = r.Dirty
+			s.Modified = r.Checksum != mig.Checksum
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, r := range applied {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: r.Version, Name: r.Name, Checksum: r.Checksum},
+			Applied:   true,
+			AppliedAt: r.AppliedAt,
+			Dirty:     r.Dirty,
+			Modified:  true,
+		})
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return a.Version - b.Version })
+	return statuses
+}
+
+func checkConsistent(statuses []Status) error {
+	for _, s := range statuses {
+		switch {
+		case s.Dirty:
+			return fmt.Errorf("%w: migration %d_%s failed partway; fix the schema by hand and delete its row from schema_migrations",
+				ErrNotUpToDate, s.Version, s.Name)
+		case s.Modified && s.Up == "":
+			return fmt.Errorf("%w: migration %d_%s was applied but its file no longer exists", ErrNotUpToDate, s.Version, s.Name)
+		case s.Modified:
+			return fmt.Errorf("%w: migration %d_%s was modified after it was applied", ErrNotUpToDate, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// MySQLのDDLはトランザクションで戻せないため、実行前にdirtyとして記録し、成功したら解除する
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, mig Migration) error {
+	if _, err := conn.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, checksum, dirty, applied_at) VALUES (?, ?, ?, TRUE, UTC_TIMESTAMP())",
+		mig.Version, mig.Name, mig.Checksum); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+	}
+	if err := execScript(ctx, conn, mig.Up); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx,
+		"UPDATE schema_migrations SET dirty = FALSE, applied_at = UTC_TIMESTAMP() WHERE version = ?", mig.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sqlx.Conn, mig Migration) error {
+	if strings.TrimSpace(mig.Down) == "" {
+		return fmt.Errorf("migration %d_%s has no down migration (mysql/migration/down/%d_%s.sql)",
+			mig.Version, mig.Name, mig.Version, mig.Name)
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", mig.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+	}
+	if err := execScript(ctx, conn, mig.Down); err != nil {
+		return fmt.Errorf("down migration %d_%s failed: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+	}
+	return nil
+}
+
+// 複数の文を含むSQLを1文ずつ実行する (DSNでmultiStatementsを有効にしなくて済むように)
+func execScript(ctx context.Context, conn *sqlx.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\n%s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// 行末の ; で文を区切る。-- で始まる行はコメントとして除く
+// 文字列リテラル内の ; やストアドプロシージャには対応しない
+func splitStatements(script string) []string {
+	var stmts []string
+	var b strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(b.String()), ";"))
+			b.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(b.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
@@ -0,0 +1,175 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// go:generate でコピーする元のマイグレーション
+const sourceDir = "../../../mysql/migration"
+
+// 埋め込んだマイグレーションが元のファイルと一致しているか (変更したら go generate ./internal/migrate を実行する)
+func TestEmbeddedMigrationsAreUpToDate(t *testing.T) {
+	source := os.DirFS(sourceDir)
+	if _, err := fs.Stat(source, "."); errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("%s not found", sourceDir)
+	}
+	embedded, err := fs.Sub(files, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := readTree(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTree(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range want {
+		if e, ok := got[name]; !ok {
+			t.Errorf("%s is not embedded; run go generate ./internal/migrate", name)
+		} else if !bytes.Equal(e, data) {
+			t.Errorf("embedded %s differs from %s; run go generate ./internal/migrate", name, sourceDir)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("embedded %s no longer exists in %s; run go generate ./internal/migrate", name, sourceDir)
+		}
+	}
+}
+
+func readTree(fsys fs.FS) (map[string][]byte, error) {
+	tree := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		tree[p] = data
+		return err
+	})
+	return tree, err
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/10_later.sql":     {Data: []byte("CREATE TABLE b (id INT);")},
+		"sql/2_first.sql":      {Data: []byte("CREATE TABLE a (id INT);")},
+		"sql/down/2_first.sql": {Data: []byte("DROP TABLE a;")},
+		"sql/README.md":        {Data: []byte("not a migration")},
+	}
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Name)
+	}
+	// 文字列ではなく番号の順に並べる
+	if !slices.Equal(got, []string{"first", "later"}) {
+		t.Fatalf("migrations = %v, want [first later]", got)
+	}
+	if migrations[0].Down != "DROP TABLE a;" || migrations[1].Down != "" {
+		t.Errorf("down = %q, %q", migrations[0].Down, migrations[1].Down)
+	}
+	if len(migrations[0].Checksum) != 64 || migrations[0].Checksum == migrations[1].Checksum {
+		t.Errorf("checksums = %q, %q", migrations[0].Checksum, migrations[1].Checksum)
+	}
+
+	fsys["sql/02_duplicate.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err := load(fsys); err == nil || !strings.Contains(err.Error(), "duplicate migration version 2") {
+		t.Errorf("err = %v, want duplicate version error", err)
+	}
+}
+
+// 埋め込んだマイグレーションが読み込めること
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for _, m := range migrations {
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("migration %d_%s is empty", m.Version, m.Name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- コメント
+CREATE TABLE a (
+  id INT -- 行末のコメントは残る
+);
+
+  -- インデントしたコメント
+INSERT INTO a VALUES (1); 
+ALTER TABLE a ADD COLUMN b INT`
+	want := []string{
+		"CREATE TABLE a (\n  id INT -- 行末のコメントは残る\n)",
+		"INSERT INTO a VALUES (1)",
+		"ALTER TABLE a ADD COLUMN b INT",
+	}
+	if got := splitStatements(script); !slices.Equal(got, want) {
+		t.Errorf("splitStatements() = %q, want %q", got, want)
+	}
+	if got := splitStatements("-- only comments\n\n"); len(got) != 0 {
+		t.Errorf("splitStatements() = %q, want none", got)
+	}
+}
+
+func TestMergeAndCheckConsistent(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: 1, Name: "one", Up: "SELECT 1", Checksum: "sum1"},
+		{Version: 2, Name: "two", Up: "SELECT 2", Checksum: "sum2"},
+	}}
+	appliedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rows    []appliedRow
+		wantErr string
+	}{
+		{"nothing applied", nil, ""},
+		{"partially applied", []appliedRow{{Version: 1, Name: "one", Checksum: "sum1", AppliedAt: appliedAt}}, ""},
+		{"dirty", []appliedRow{{Version: 1, Name: "one", Checksum: "sum1", Dirty: true}}, "migration 1_one failed partway"},
+		{"modified", []appliedRow{{Version: 2, Name: "two", Checksum: "old"}}, "migration 2_two was modified"},
+		{"file removed", []appliedRow{{Version: 3, Name: "three", Checksum: "sum3"}}, "migration 3_three was applied but its file no longer exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses := m.merge(tt.rows)
+			for i := 1; i < len(statuses); i++ {
+				if statuses[i-1].Version >= statuses[i].Version {
+					t.Fatalf("statuses are not sorted: %+v", statuses)
+				}
+			}
+			err := checkConsistent(statuses)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNotUpToDate) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	statuses := m.merge([]appliedRow{{Version: 1, Name: "one", Checksum: "sum1", AppliedAt: appliedAt}})
+	if !statuses[0].Applied || !statuses[0].AppliedAt.Equal(appliedAt) || statuses[1].Applied {
+		t.Errorf("statuses = %+v", statuses)
+	}
+}
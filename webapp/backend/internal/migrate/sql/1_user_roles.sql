@@ -0,0 +1,3 @@
+-- ユーザーにロールを追加する (admin / customer)
+ALTER TABLE users
+  ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer';
@@ -0,0 +1,21 @@
+-- 注文のドメインイベント (OrderCreated・OrderClaimed・OrderDelivered)
+-- 注文の変更と同じトランザクションで記録し、リレーが古い順に取得してコミットしてから配信する
+-- next_attempt_atまでは他のリレーが取得せず、配信済みと配信を諦めたイベントはNULLにする
+-- event_idは配信先での重複排除に使う
+CREATE TABLE outbox_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    aggregate_id BIGINT UNSIGNED NOT NULL,
+    payload JSON NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    published_at DATETIME(6) NULL DEFAULT NULL,
+    next_attempt_at DATETIME(6) NULL DEFAULT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    UNIQUE KEY uq_outbox_events_event_id (event_id),
+    INDEX idx_outbox_events_pending (published_at, id),
+    INDEX idx_outbox_events_due (next_attempt_at)
+) ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
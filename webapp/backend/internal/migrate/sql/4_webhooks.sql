@@ -0,0 +1,48 @@
+-- 注文のドメインイベントを外部に通知するWebhook
+-- outboxのリレーがイベントを初めて取得したときに、同じトランザクションで登録ごとの配信を予約する
+
+-- Webhookの登録 (event_typesはカンマ区切りのイベントの種類)
+CREATE TABLE webhook_subscriptions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types VARCHAR(255) NOT NULL,
+    created_at DATETIME(6) NOT NULL
+) ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+-- 未配信の配信 (配信に成功したら削除し、失敗したらnext_attempt_atを延ばす)
+CREATE TABLE webhook_deliveries (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    subscription_id BIGINT UNSIGNED NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    body JSON NOT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(6) NOT NULL,
+    last_error TEXT NULL,
+    created_at DATETIME(6) NOT NULL,
+    UNIQUE KEY uq_webhook_deliveries_event (subscription_id, event_id),
+    INDEX idx_webhook_deliveries_due (next_attempt_at),
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE
+) ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
+
+-- 再試行の上限に達した配信 (再送APIでwebhook_deliveriesに戻す)
+CREATE TABLE webhook_dead_letters (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    subscription_id BIGINT UNSIGNED NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    body JSON NOT NULL,
+    attempts INT UNSIGNED NOT NULL,
+    last_error TEXT NULL,
+    created_at DATETIME(6) NOT NULL,
+    failed_at DATETIME(6) NOT NULL,
+    INDEX idx_webhook_dead_letters_subscription (subscription_id, id),
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE
+) ENGINE=InnoDB
+DEFAULT CHARSET=utf8mb4
+COLLATE=utf8mb4_0900_ai_ci;
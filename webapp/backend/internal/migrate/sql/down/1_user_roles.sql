@@ -0,0 +1,3 @@
+-- 1_user_roles.sql で追加したロールを削除する
+ALTER TABLE users
+  DROP COLUMN role;
@@ -0,0 +1,4 @@
+-- 2_products_soft_delete.sql で追加した論理削除用カラムを削除する
+-- 論理削除済みの商品は削除されていない状態に戻る
+ALTER TABLE products
+  DROP COLUMN deleted_at;
@@ -0,0 +1,6 @@
+-- 4_webhooks.sql で追加したテーブルを削除する (未配信の配信と再送待ちの配信も削除される)
+DROP TABLE webhook_dead_letters;
+
+DROP TABLE webhook_deliveries;
+
+DROP TABLE webhook_subscriptions;
@@ -2,13 +2,27 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+// ユーザーのロール
+const (
+	RoleAdmin    = "admin"
+	RoleCustomer = "customer"
+)
+
 type User struct {
 	UserID       int    `db:"user_id"`
 	PasswordHash string `db:"password_hash"`
 	UserName     string `db:"user_name"`
+	Role         string `db:"role"`
+}
+
+// セッションから特定したユーザー
+type SessionUser struct {
+	UserID int    `db:"user_id"`
+	Role   string `db:"role"`
 }
 
 type Product struct {
@@ -20,6 +34,30 @@ type Product struct {
 	Description string `db:"description"  json:"description"`
 }
 
+// 管理者による商品の作成・更新リクエスト
+type ProductInput struct {
+	Name        string `json:"name"`
+	Value       int    `json:"value"`
+	Weight      int    `json:"weight"`
+	Image       string `json:"image"`
+	Description string `json:"description"`
+}
+
+// アップロードされた商品画像と生成された派生画像
+type ProductImage struct {
+	Path     string         `json:"path"`
+	Format   string         `json:"format"`
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Variants []ImageVariant `json:"variants"`
+}
+
+type ImageVariant struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+}
+
 type Order struct {
 	OrderID       int64        `db:"order_id"        json:"order_id"`
 	UserID        int          `db:"user_id"         json:"user_id"`
@@ -32,6 +70,88 @@ type Order struct {
 	ArrivedAt     sql.NullTime `db:"arrived_at"      json:"arrived_at"`
 }
 
+// 注文ステータスの変更 (GET /api/v1/orders/stream で配信する)
+// IDはRedis Streamのエントリ"<ミリ秒>-<連番>"で、SSEのidとLast-Event-IDに使う
+type OrderEvent struct {
+	ID            string    `json:"id,omitempty"`
+	OrderID       int64     `json:"order_id"`
+	UserID        int       `json:"user_id"`
+	ShippedStatus string    `json:"shipped_status"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+// 注文のドメインイベントの種類
+const (
+	EventOrderCreated   = "OrderCreated"
+	EventOrderClaimed   = "OrderClaimed"
+	EventOrderDelivered = "OrderDelivered"
+)
+
+// 変更と同じトランザクションでoutbox_eventsに記録し、リレーが配信するイベント
+// 少なくとも1回配信するため、配信先はEventIDで重複を取り除く
+// NextAttemptAtはリレーが次に取得できる時刻 (配信済みと配信を諦めたイベントは無効)、Attemptsは取得した回数
+type OutboxEvent struct {
+	ID            int64           `db:"id"              json:"-"`
+	EventID       string          `db:"event_id"        json:"event_id"`
+	EventType     string          `db:"event_type"      json:"event_type"`
+	AggregateID   int64           `db:"aggregate_id"    json:"aggregate_id"`
+	Payload       json.RawMessage `db:"payload"         json:"payload"`
+	CreatedAt     time.Time       `db:"created_at"      json:"occurred_at"`
+	PublishedAt   sql.NullTime    `db:"published_at"    json:"-"`
+	NextAttemptAt sql.NullTime    `db:"next_attempt_at" json:"-"`
+	Attempts      int             `db:"attempts"        json:"-"`
+	LastError     sql.NullString  `db:"last_error"      json:"-"`
+}
+
+// 注文のドメインイベントの内容 (OutboxEvent.Payload)
+type OrderEventPayload struct {
+	OrderID       int64  `json:"order_id"`
+	UserID        int    `json:"user_id"`
+	ProductID     int    `json:"product_id,omitempty"`
+	ShippedStatus string `json:"shipped_status"`
+}
+
+// Webhookの登録 (Secretは作成時のレスポンスでのみ返す)
+type WebhookSubscription struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Webhookの登録のリクエスト
+type WebhookSubscriptionInput struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+// 送信待ちのWebhook (BodyはOutboxEventのJSON)
+type WebhookDelivery struct {
+	ID             int64           `db:"id"`
+	SubscriptionID int64           `db:"subscription_id"`
+	URL            string          `db:"url"`
+	Secret         string          `db:"secret"`
+	EventID        string          `db:"event_id"`
+	EventType      string          `db:"event_type"`
+	Body           json.RawMessage `db:"body"`
+	Attempts       int             `db:"attempts"`
+	CreatedAt      time.Time       `db:"created_at"`
+}
+
+// 再試行の上限に達したWebhook
+type WebhookDeadLetter struct {
+	ID             int64           `db:"id"              json:"id"`
+	SubscriptionID int64           `db:"subscription_id" json:"subscription_id"`
+	EventID        string          `db:"event_id"        json:"event_id"`
+	EventType      string          `db:"event_type"      json:"event_type"`
+	Body           json.RawMessage `db:"body"            json:"body"`
+	Attempts       int             `db:"attempts"        json:"attempts"`
+	LastError      string          `db:"last_error"      json:"last_error"`
+	CreatedAt      time.Time       `db:"created_at"      json:"created_at"`
+	FailedAt       time.Time       `db:"failed_at"       json:"failed_at"`
+}
+
 type DeliveryPlan struct {
 	RobotID     string  `json:"robot_id"`
 	TotalWeight int     `json:"total_weight"`
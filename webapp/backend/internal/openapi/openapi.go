@@ -0,0 +1,32 @@
+// OpenAPI定義(documents/api-specs/openapi_defn.yaml)によるリクエスト・レスポンスの検証
+// 定義を正とし、実装とのずれは検証エラーとして表に出す
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Dockerのビルドコンテキストがbackend配下のため、定義のコピーを埋め込む
+// 定義を変更したら go generate ./internal/openapi で更新すること
+//
+//go:generate cp ../../../../documents/api-specs/openapi_defn.yaml openapi.yaml
+//go:embed openapi.yaml
+var spec []byte
+
+// 埋め込んだ定義を読み込み、定義自体が正しいか検証する
+func Load(ctx context.Context) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi spec: %w", err)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,33 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+// go:generate で取り込む元の定義
+const sourceSpecPath = "../../../../documents/api-specs/openapi_defn.yaml"
+
+// 埋め込んだ定義が元の定義と一致しているか (定義を編集したら go generate ./internal/openapi を実行する)
+func TestEmbeddedSpecIsUpToDate(t *testing.T) {
+	source, err := os.ReadFile(sourceSpecPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("%s not found", sourceSpecPath)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spec, source) {
+		t.Fatalf("internal/openapi/openapi.yaml differs from %s; run go generate ./internal/openapi", sourceSpecPath)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,238 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"backend/internal/apierror"
+	"backend/internal/logging"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// レスポンスの検証方法
+const (
+	// 検証しない
+	ResponseOff = "off"
+	// 定義に合わないレスポンスをログに出す (レスポンスはそのまま返す)
+	ResponseLog = "log"
+	// 定義に合わないレスポンスを500に置き換える (開発・テスト環境向け)
+	ResponseStrict = "strict"
+)
+
+// 定義に合わないレスポンスを置き換えた場合のコード
+const CodeResponseInvalid = "response_validation_failed"
+
+type Validator struct {
+	router    routers.Router
+	requests  bool
+	responses string
+}
+
+// requestsがfalseの場合はリクエストを検証しない
+// responsesはResponseOff / ResponseLog / ResponseStrictのいずれか
+func NewValidator(doc *openapi3.T, requests bool, responses string) (*Validator, error) {
+	switch responses {
+	case ResponseOff, ResponseLog, ResponseStrict:
+	default:
+		return nil, fmt.Errorf("invalid response validation mode %q", responses)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build openapi router: %w", err)
+	}
+	return &Validator{router: router, requests: requests, responses: responses}, nil
+}
+
+// 定義にあるルートのリクエスト・レスポンスを検証する
+// 認証は既存のミドルウェアで行うため、認証・CSRFの後に置く
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	if !v.requests && v.responses == ResponseOff {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			// 定義にないルートはそのまま通す (404・405はchiが返す)
+			next.ServeHTTP(w, r)
+			return
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				// 画像のアップロードは本文を読み込まず、ハンドラーで検証する
+				ExcludeRequestBody: isMultipart(r.Header.Get("Content-Type")),
+			},
+		}
+
+		if v.requests {
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				writeRequestError(w, err)
+				return
+			}
+		}
+		if v.responses == ResponseOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.passthrough {
+			return
+		}
+		v.checkResponse(rec, input)
+	})
+}
+
+// 記録したJSONレスポンスを検証してから送信する
+func (v *Validator) checkResponse(rec *responseRecorder, input *openapi3filter.RequestValidationInput) {
+	if !rec.wroteHeader {
+		rec.status = http.StatusOK
+	}
+	err := openapi3filter.ValidateResponse(input.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.status,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.buf.Bytes())),
+		Options:                &openapi3filter.Options{MultiError: true},
+	})
+	w := rec.ResponseWriter
+	if err != nil {
+		r := input.Request
+		logging.Warn(r.Context(), "response does not match openapi spec",
+			"method", r.Method, "route", input.Route.Path, "status", rec.status, "error", err)
+		if v.responses == ResponseStrict {
+			apierror.Write(w, http.StatusInternalServerError, CodeResponseInvalid,
+				"response does not match the api specification", fieldErrors(err))
+			return
+		}
+	}
+	w.WriteHeader(rec.status)
+	_, _ = w.Write(rec.buf.Bytes())
+}
+
+// リクエストの検証エラーを返す
+// ボディサイズの上限を超えた場合は413、それ以外は400
+func writeRequestError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		apierror.TooLarge(w, maxBytesErr.Limit)
+		return
+	}
+	apierror.Write(w, http.StatusBadRequest, apierror.CodeValidationFailed,
+		"request does not match the api specification", fieldErrors(err))
+}
+
+// 検証エラーをフィールドごとの詳細に変換する
+func fieldErrors(err error) []apierror.FieldError {
+	var out []apierror.FieldError
+	var walk func(prefix string, err error)
+	walk = func(prefix string, err error) {
+		var multi openapi3.MultiError
+		var reqErr *openapi3filter.RequestError
+		var respErr *openapi3filter.ResponseError
+		var schemaErr *openapi3.SchemaError
+		switch {
+		case errors.As(err, &multi):
+			for _, e := range multi {
+				walk(prefix, e)
+			}
+		case errors.As(err, &reqErr):
+			field := prefix
+			if reqErr.Parameter != nil {
+				field = reqErr.Parameter.Name
+			}
+			if reqErr.Err == nil {
+				out = append(out, apierror.FieldError{Field: field, Message: reqErr.Reason})
+				return
+			}
+			walk(field, reqErr.Err)
+		case errors.As(err, &respErr):
+			if respErr.Err == nil {
+				out = append(out, apierror.FieldError{Field: prefix, Message: respErr.Reason})
+				return
+			}
+			walk(prefix, respErr.Err)
+		case errors.As(err, &schemaErr):
+			field := strings.Join(schemaErr.JSONPointer(), ".")
+			if prefix != "" && field != "" {
+				field = prefix + "." + field
+			} else if field == "" {
+				field = prefix
+			}
+			out = append(out, apierror.FieldError{Field: field, Message: schemaErr.Reason})
+		default:
+			out = append(out, apierror.FieldError{Field: prefix, Message: err.Error()})
+		}
+	}
+	walk("", err)
+	return out
+}
+
+func isMultipart(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "multipart/")
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// JSONレスポンスを検証のためにバッファし、それ以外(画像・テキスト・ストリーム)はそのまま書き込む
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.status = status
+	if !isJSON(rec.Header().Get("Content-Type")) {
+		rec.passthrough = true
+		rec.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.passthrough {
+		return rec.ResponseWriter.Write(b)
+	}
+	return rec.buf.Write(b)
+}
+
+func (rec *responseRecorder) Flush() {
+	if !rec.passthrough {
+		return
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// http.ResponseControllerから元のResponseWriterを参照できるようにする
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
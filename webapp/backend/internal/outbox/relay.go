@@ -0,0 +1,233 @@
+// 注文のドメインイベントをoutbox_eventsから読み出し、配信先に送る
+package outbox
+
+import (
+	"backend/internal/metrics"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// 1バッチの配信にかける時間の上限
+	batchTimeout = 30 * time.Second
+	// 取得したイベントを他のリレーが取得しない時間 (配信のタイムアウトより長くする)
+	claimLease = batchTimeout + 30*time.Second
+	// 配信済みのイベントを削除する間隔
+	cleanupInterval = time.Hour
+)
+
+type Config struct {
+	// 未配信のイベントを確認する間隔
+	PollInterval time.Duration
+	// 1回に取得して配信するイベント数
+	BatchSize int
+	// 配信済みのイベントを残す期間 (0の場合は削除しない)
+	Retention time.Duration
+	// この回数配信に失敗したイベントは配信を諦める
+	MaxAttempts int
+	// 再送の間隔の上限 (失敗するたびにPollIntervalから倍にする)
+	BackoffMax time.Duration
+	// Webhookの登録ごとに配信を予約する (送信はwebhook.Dispatcherが行う)
+	Webhooks bool
+}
+
+// 未配信のイベントを定期的に配信する
+// イベントはトランザクション内で取得してコミットし、ロックを持たずに配信してから結果を記録する
+// 結果を記録する前に止まった場合はlease後に配信し直すため、配信は少なくとも1回となる
+// 失敗したイベントは間隔を空けて再送するため、配信の順序は保証しない
+// sinkがnilの場合はWebhookの予約のみ行う
+type Relay struct {
+	store *repository.Store
+	sink  Sink
+	cfg   Config
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewRelay(store *repository.Store, sink Sink, cfg Config) *Relay {
+	return &Relay{
+		store: store,
+		sink:  sink,
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// バックグラウンドで配信を始める
+func (r *Relay) Start() {
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.cfg.PollInterval)
+		defer ticker.Stop()
+		var lastCleanup time.Time
+		for {
+			r.drain()
+			if r.cfg.Retention > 0 && time.Since(lastCleanup) >= cleanupInterval {
+				r.cleanup()
+				lastCleanup = time.Now()
+			}
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// 配信を止める (配信中のバッチは完了を待つ)
+func (r *Relay) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 未配信のイベントがなくなるか、配信に失敗するまで配信する
+func (r *Relay) drain() {
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		n, err := r.publishBatch()
+		if err != nil {
+			slog.Warn("outbox relay failed", "sink", r.sinkName(), "error", err)
+			return
+		}
+		if n < r.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// 1バッチを配信し、取得した件数を返す
+func (r *Relay) publishBatch() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+
+	var events []model.OutboxEvent
+	err := r.store.ExecTx(ctx, func(txStore *repository.Store) error {
+		var err error
+		events, err = txStore.OutboxRepo.ClaimPending(ctx, time.Now(), r.cfg.BatchSize, claimLease)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		// 配信先の結果によらず、初めて取得したときに一度だけ予約する
+		if r.cfg.Webhooks {
+			if _, err := txStore.WebhookRepo.Enqueue(ctx, firstAttempts(events), time.Now()); err != nil {
+				return err
+			}
+		}
+		if r.sink == nil {
+			return txStore.OutboxRepo.MarkPublished(ctx, eventIDs(events), time.Now())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if r.sink != nil {
+		if err := r.sink.Publish(ctx, events); err != nil {
+			r.fail(ctx, events, err)
+			return len(events), err
+		}
+		// 記録に失敗した場合はlease後に配信し直す
+		if err := r.store.OutboxRepo.MarkPublished(ctx, eventIDs(events), time.Now()); err != nil {
+			return len(events), fmt.Errorf("failed to mark outbox events as published: %w", err)
+		}
+	}
+	metrics.OutboxEvents(r.sinkName(), "published", len(events))
+	metrics.SetOutboxLag(time.Since(events[0].CreatedAt))
+	return len(events), nil
+}
+
+// 配信に失敗したイベントを、取得した回数に応じて間隔を空けて再送する
+// MaxAttempts回失敗したイベントは配信を諦め、last_errorを残して再送しない
+func (r *Relay) fail(ctx context.Context, events []model.OutboxEvent, publishErr error) {
+	metrics.OutboxEvents(r.sinkName(), "failed", len(events))
+	byAttempts := make(map[int][]int64)
+	for _, e := range events {
+		byAttempts[e.Attempts] = append(byAttempts[e.Attempts], e.ID)
+	}
+	for attempts, ids := range byAttempts {
+		var err error
+		if attempts >= r.cfg.MaxAttempts {
+			err = r.store.OutboxRepo.MarkFailed(ctx, ids, publishErr.Error())
+			metrics.OutboxEvents(r.sinkName(), "abandoned", len(ids))
+			slog.Error("outbox events abandoned after max attempts",
+				"sink", r.sinkName(), "events", len(ids), "attempts", attempts, "error", publishErr)
+		} else {
+			err = r.store.OutboxRepo.RetryLater(ctx, ids, time.Now().Add(r.backoff(attempts)), publishErr.Error())
+		}
+		// 記録に失敗したイベントはlease後に再送される
+		if err != nil {
+			slog.Warn("failed to record outbox publish failure", "sink", r.sinkName(), "events", len(ids), "error", err)
+		}
+	}
+}
+
+// attempts回失敗した後の再送までの間隔
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.cfg.BackoffMax
+	if shift := attempts - 1; shift < 32 {
+		if b := r.cfg.PollInterval << shift; b > 0 && b < wait {
+			wait = b
+		}
+	}
+	return wait
+}
+
+// 初めて取得したイベント (再送のたびにWebhookを予約しないようにする)
+func firstAttempts(events []model.OutboxEvent) []model.OutboxEvent {
+	var first []model.OutboxEvent
+	for _, e := range events {
+		if e.Attempts == 1 {
+			first = append(first, e)
+		}
+	}
+	return first
+}
+
+func eventIDs(events []model.OutboxEvent) []int64 {
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func (r *Relay) sinkName() string {
+	if r.sink == nil {
+		return "none"
+	}
+	return r.sink.Name()
+}
+
+// 保持期間を過ぎた配信済みのイベントを削除する
+func (r *Relay) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+	n, err := r.store.OutboxRepo.DeletePublished(ctx, time.Now().Add(-r.cfg.Retention))
+	if err != nil {
+		slog.Warn("failed to delete published outbox events", "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("deleted published outbox events", "events", n)
+	}
+}
@@ -0,0 +1,234 @@
+package outbox
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Publishの呼び出しを記録し、failsが残っている間は失敗するSink
+type testSink struct {
+	mu        sync.Mutex
+	fails     int
+	published []model.OutboxEvent
+	calls     int
+	// Publishの中で呼ぶ (トランザクション外で呼ばれていることの確認用)
+	onPublish func()
+}
+
+func (s *testSink) Name() string { return "test" }
+
+func (s *testSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	if s.onPublish != nil {
+		s.onPublish()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("sink is unavailable")
+	}
+	s.published = append(s.published, events...)
+	return nil
+}
+
+func newTestRelay(t *testing.T, sink Sink, cfg Config) (*Relay, *repository.Store) {
+	t.Helper()
+	store := repository.NewMemoryStore(repository.NewMemoryDB())
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = time.Minute
+		cfg.BackoffMax = time.Hour
+	}
+	return NewRelay(store, sink, cfg), store
+}
+
+func addTestEvents(t *testing.T, store *repository.Store, n int) {
+	t.Helper()
+	events := make([]model.OutboxEvent, n)
+	for i := range events {
+		events[i] = model.OutboxEvent{
+			EventID:     fmt.Sprintf("event-%d", i+1),
+			EventType:   model.EventOrderCreated,
+			AggregateID: int64(i + 1),
+			Payload:     []byte(`{}`),
+			CreatedAt:   time.Now(),
+		}
+	}
+	if err := store.OutboxRepo.Add(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// at時点で取得できるイベント
+func dueEvents(t *testing.T, store *repository.Store, at time.Time) []model.OutboxEvent {
+	t.Helper()
+	events, err := store.OutboxRepo.ClaimPending(context.Background(), at, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestRelayPublishesOutsideTransaction(t *testing.T) {
+	sink := &testSink{}
+	relay, store := newTestRelay(t, sink, Config{})
+	addTestEvents(t, store, 3)
+
+	// トランザクション内で呼ばれると、メモリのStoreはコミットまでロックを待つ
+	sink.onPublish = func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = store.OrderRepo.GetShippingOrders(context.Background())
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Publish is called while the claim transaction is open")
+		}
+	}
+
+	n, err := relay.publishBatch()
+	if err != nil || n != 3 {
+		t.Fatalf("publishBatch() = %d, %v", n, err)
+	}
+	if len(sink.published) != 3 || sink.published[0].EventID != "event-1" {
+		t.Errorf("published = %+v", sink.published)
+	}
+	// 配信済みのイベントは取得しない
+	if events := dueEvents(t, store, time.Now().Add(24*time.Hour)); len(events) != 0 {
+		t.Errorf("events after publish = %+v", events)
+	}
+	if n, err := relay.publishBatch(); err != nil || n != 0 {
+		t.Errorf("second publishBatch() = %d, %v", n, err)
+	}
+}
+
+func TestRelayRetriesWithBackoff(t *testing.T) {
+	sink := &testSink{fails: 1}
+	relay, store := newTestRelay(t, sink, Config{PollInterval: time.Minute, BackoffMax: time.Hour})
+	addTestEvents(t, store, 2)
+
+	if _, err := relay.publishBatch(); err == nil {
+		t.Fatal("publishBatch() succeeded while the sink fails")
+	}
+	// 失敗したイベントはPollInterval後まで取得しない
+	if n, err := relay.publishBatch(); err != nil || n != 0 {
+		t.Fatalf("publishBatch() right after a failure = %d, %v", n, err)
+	}
+	events := dueEvents(t, store, time.Now().Add(2*time.Minute))
+	if len(events) != 2 || events[0].Attempts != 2 || events[0].LastError.String != "sink is unavailable" {
+		t.Fatalf("events after failure = %+v", events)
+	}
+}
+
+func TestRelayAbandonsAfterMaxAttempts(t *testing.T) {
+	sink := &testSink{fails: 100}
+	relay, store := newTestRelay(t, sink, Config{MaxAttempts: 3, PollInterval: time.Millisecond, BackoffMax: time.Millisecond})
+	addTestEvents(t, store, 2)
+
+	for range 5 {
+		_, _ = relay.publishBatch()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if sink.calls != 3 {
+		t.Errorf("sink was called %d times, want 3", sink.calls)
+	}
+	if events := dueEvents(t, store, time.Now().Add(24*time.Hour)); len(events) != 0 {
+		t.Errorf("abandoned events are still claimed: %+v", events)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := &Relay{cfg: Config{PollInterval: time.Second, BackoffMax: time.Minute}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{64, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// Webhookは配信先の結果によらず、イベントごとに一度だけ予約する
+func TestRelayEnqueuesWebhooksOnce(t *testing.T) {
+	ctx := context.Background()
+	sink := &testSink{fails: 2}
+	relay, store := newTestRelay(t, sink, Config{PollInterval: time.Millisecond, BackoffMax: time.Millisecond, MaxAttempts: 5, Webhooks: true})
+	if _, err := store.WebhookRepo.CreateSubscription(ctx, &model.WebhookSubscription{
+		URL: "https://example.com/hook", Secret: "whsec_test", EventTypes: []string{model.EventOrderCreated},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addTestEvents(t, store, 2)
+
+	if _, err := relay.publishBatch(); err == nil {
+		t.Fatal("publishBatch() succeeded while the sink fails")
+	}
+	deliveries, err := store.WebhookRepo.ClaimDue(ctx, time.Now(), 100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("deliveries after a sink failure = %d, want 2", len(deliveries))
+	}
+	// 送信済みとして削除しても、再送で予約し直さない
+	for _, d := range deliveries {
+		if err := store.WebhookRepo.DeleteDelivery(ctx, d.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 3 {
+		time.Sleep(5 * time.Millisecond)
+		_, _ = relay.publishBatch()
+	}
+	if len(sink.published) != 2 {
+		t.Fatalf("published = %d, want 2", len(sink.published))
+	}
+	if deliveries, err := store.WebhookRepo.ClaimDue(ctx, time.Now().Add(24*time.Hour), 100, 0); err != nil || len(deliveries) != 0 {
+		t.Errorf("deliveries after retries = %+v, %v", deliveries, err)
+	}
+}
+
+// sinkがない場合は予約と同じトランザクションで配信済みにする
+func TestRelayWithoutSink(t *testing.T) {
+	ctx := context.Background()
+	relay, store := newTestRelay(t, nil, Config{Webhooks: true})
+	if _, err := store.WebhookRepo.CreateSubscription(ctx, &model.WebhookSubscription{
+		URL: "https://example.com/hook", Secret: "whsec_test", EventTypes: []string{model.EventOrderCreated},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addTestEvents(t, store, 2)
+
+	if n, err := relay.publishBatch(); err != nil || n != 2 {
+		t.Fatalf("publishBatch() = %d, %v", n, err)
+	}
+	if events := dueEvents(t, store, time.Now().Add(24*time.Hour)); len(events) != 0 {
+		t.Errorf("events after publish = %+v", events)
+	}
+	deliveries, err := store.WebhookRepo.ClaimDue(ctx, time.Now(), 100, time.Hour)
+	if err != nil || len(deliveries) != 2 {
+		t.Errorf("deliveries = %+v, %v", deliveries, err)
+	}
+}
@@ -0,0 +1,125 @@
+package outbox
+
+import (
+	"backend/internal/logging"
+	"backend/internal/model"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// イベントの配信先
+// Publishがエラーを返した場合、リレーはバッチ全体を後で配信し直す (一部が届いていても送り直す)
+type Sink interface {
+	// メトリクス・ログに使う名前
+	Name() string
+	Publish(ctx context.Context, events []model.OutboxEvent) error
+}
+
+// ログに出力する (ローカルでの確認用。debugレベルで出力する)
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	for _, e := range events {
+		logging.Debug(ctx, "outbox event",
+			"event_id", e.EventID, "event_type", e.EventType, "aggregate_id", e.AggregateID, "payload", string(e.Payload))
+	}
+	return nil
+}
+
+// 同じevent_idを重複して追加しないよう、dedupキーを保持する期間
+const redisDedupTTL = 24 * time.Hour
+
+// dedupキーを設定できた(初めて配信する)場合だけStreamに追加する
+// KEYS[1]: Stream, KEYS[2]: dedupキー
+// ARGV: TTL(秒), MAXLEN, event_id, event_type, aggregate_id, payload, occurred_at
+var redisPublishScript = `
+if redis.call('SET', KEYS[2], '1', 'NX', 'EX', ARGV[1]) then
+  return redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[2], '*',
+    'event_id', ARGV[3], 'event_type', ARGV[4], 'aggregate_id', ARGV[5], 'payload', ARGV[6], 'occurred_at', ARGV[7])
+end
+return false
+`
+
+// Redis Streamに追加する
+// 配信し直した場合も、dedupキーの保持期間内であれば同じイベントは一度だけ追加される
+type RedisStreamSink struct {
+	rdb    *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamSink(rdb *redis.Client, stream string, maxLen int64) *RedisStreamSink {
+	return &RedisStreamSink{rdb: rdb, stream: stream, maxLen: maxLen}
+}
+
+func (s *RedisStreamSink) Name() string { return "redis" }
+
+func (s *RedisStreamSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	cmds := make([]*redis.Cmd, len(events))
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, e := range events {
+			cmds[i] = pipe.Eval(ctx, redisPublishScript,
+				[]string{s.stream, s.stream + ":dedup:" + e.EventID},
+				int64(redisDedupTTL/time.Second), s.maxLen,
+				e.EventID, e.EventType, e.AggregateID, []byte(e.Payload), e.CreatedAt.UTC().Format(time.RFC3339Nano))
+		}
+		return nil
+	})
+	// 配信済みのイベントはnilを返すため、個々の結果で判定する
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to add events to redis stream %s: %w", s.stream, err)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("failed to add events to redis stream %s: %w", s.stream, err)
+		}
+	}
+	return nil
+}
+
+// 指定したURLにイベントをJSONでPOSTする
+// 本文は {"events": [...]} で、2xx以外の応答はエラーとして配信し直す
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	body, err := json.Marshal(struct {
+		Events []model.OutboxEvent `json:"events"`
+	}{Events: events})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"backend/internal/logging"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ログイン試行回数とロックアウト状態を管理する
+// Redisが使えない場合はプロセス内のメモリにフォールバックする
+type LoginAttemptRepository struct {
+	rdb *redis.Client
+	mem *memoryCounter
+}
+
+func NewLoginAttemptRepository(rdb *redis.Client) *LoginAttemptRepository {
+	return &LoginAttemptRepository{rdb: rdb, mem: newMemoryCounter()}
+}
+
+// 失敗回数をインクリメントし、現在の回数を返す
+// windowは最初の失敗からカウンタが保持される期間
+func (r *LoginAttemptRepository) IncrFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	fullKey := "login:fail:" + key
+	if r.rdb != nil {
+		var incr *redis.IntCmd
+		_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			incr = pipe.Incr(ctx, fullKey)
+			pipe.ExpireNX(ctx, fullKey, window)
+			return nil
+		})
+		if err == nil {
+			return incr.Val(), nil
+		}
+		logging.Warn(ctx, "login attempt counter: redis incr failed, falling back to memory", "error", err)
+	}
+	return r.mem.incr(fullKey, window), nil
+}
+
+// 失敗回数とロックをリセットする (ログイン成功時)
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	failKey := "login:fail:" + key
+	lockKey := "login:lock:" + key
+	r.mem.del(failKey, lockKey)
+	if r.rdb != nil {
+		if err := r.rdb.Del(ctx, failKey, lockKey).Err(); err != nil {
+			logging.Warn(ctx, "login attempt counter: redis del failed", "error", err)
+		}
+	}
+	return nil
+}
+
+// 指定期間ロックする
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, duration time.Duration) error {
+	lockKey := "login:lock:" + key
+	if r.rdb != nil {
+		err := r.rdb.Set(ctx, lockKey, 1, duration).Err()
+		if err == nil {
+			return nil
+		}
+		logging.Warn(ctx, "login attempt counter: redis set failed, falling back to memory", "error", err)
+	}
+	r.mem.set(lockKey, duration)
+	return nil
+}
+
+// ロック中であれば残り時間を返す (ロックされていなければ0)
+func (r *LoginAttemptRepository) LockRemaining(ctx context.Context, key string) (time.Duration, error) {
+	lockKey := "login:lock:" + key
+	if r.rdb != nil {
+		ttl, err := r.rdb.PTTL(ctx, lockKey).Result()
+		if err == nil {
+			if ttl < 0 {
+				return 0, nil
+			}
+			return ttl, nil
+		}
+		logging.Warn(ctx, "login attempt counter: redis pttl failed, falling back to memory", "error", err)
+	}
+	return r.mem.ttl(lockKey), nil
+}
+
+const memoryCounterSweepSize = 10000
+
+// Redis障害時に使うTTL付きのカウンタ
+type memoryCounter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func newMemoryCounter() *memoryCounter {
+	return &memoryCounter{entries: make(map[string]*memoryEntry)}
+}
+
+func (m *memoryCounter) get(key string, now time.Time) *memoryEntry {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expiresAt) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (m *memoryCounter) incr(key string, window time.Duration) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if len(m.entries) >= memoryCounterSweepSize {
+		m.sweep(now)
+	}
+	e := m.get(key, now)
+	if e == nil {
+		e = &memoryEntry{expiresAt: now.Add(window)}
+		m.entries[key] = e
+	}
+	e.count++
+	return e.count
+}
+
+// 期限切れのエントリをまとめて削除する
+func (m *memoryCounter) sweep(now time.Time) {
+	for k, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, k)
+		}
+	}
+}
+
+func (m *memoryCounter) set(key string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = &memoryEntry{count: 1, expiresAt: time.Now().Add(duration)}
+}
+
+func (m *memoryCounter) ttl(key string) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	e := m.get(key, now)
+	if e == nil {
+		return 0
+	}
+	return e.expiresAt.Sub(now)
+}
+
+func (m *memoryCounter) del(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.entries, k)
+	}
+}
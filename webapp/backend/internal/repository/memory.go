@@ -0,0 +1,965 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// MySQLの代わりにメモリ上にデータを持つStore (ユニットテスト・ローカル検証用)
+// トランザクションはデータ全体のコピーに対して行い、コミット時に置き換える
+// トランザクション中は他の読み書きを待たせるため、分離レベルはSERIALIZABLE相当になる
+type MemoryDB struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+type memoryData struct {
+	users    map[int]model.User
+	sessions map[string]memorySession
+	products map[int]memoryProduct
+	orders   map[int64]model.Order
+	outbox   []model.OutboxEvent
+	webhooks map[int64]model.WebhookSubscription
+	// 配信と再送待ちの配信 (IDの順)
+	deliveries  []memoryDelivery
+	deadLetters []model.WebhookDeadLetter
+
+	nextUserID    int
+	nextProductID int
+	nextOrderID   int64
+	nextOutboxID  int64
+	nextWebhookID int64
+	// 配信と再送待ちの配信で共通
+	nextDeliveryID int64
+}
+
+type memoryDelivery struct {
+	model.WebhookDelivery
+	nextAttemptAt time.Time
+	lastError     string
+}
+
+type memorySession struct {
+	userID    int
+	expiresAt time.Time
+}
+
+type memoryProduct struct {
+	model.Product
+	deleted bool
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{data: &memoryData{
+		users:         make(map[int]model.User),
+		sessions:      make(map[string]memorySession),
+		products:      make(map[int]memoryProduct),
+		orders:        make(map[int64]model.Order),
+		webhooks:      make(map[int64]model.WebhookSubscription),
+		nextUserID:    1,
+		nextProductID: 1,
+		nextOrderID:   1,
+		nextOutboxID:  1,
+		nextWebhookID: 1,
+
+		nextDeliveryID: 1,
+	}}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.users = maps.Clone(d.users)
+	c.sessions = maps.Clone(d.sessions)
+	c.products = maps.Clone(d.products)
+	c.orders = maps.Clone(d.orders)
+	c.outbox = slices.Clone(d.outbox)
+	c.webhooks = maps.Clone(d.webhooks)
+	c.deliveries = slices.Clone(d.deliveries)
+	c.deadLetters = slices.Clone(d.deadLetters)
+	return &c
+}
+
+// ユーザーを追加する (UserIDが0の場合は採番する)
+// ユーザー作成のAPIはないため、テストデータの投入に使う
+func (m *MemoryDB) AddUser(user model.User) model.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.data
+	if user.UserID == 0 {
+		user.UserID = d.nextUserID
+	}
+	if user.UserID >= d.nextUserID {
+		d.nextUserID = user.UserID + 1
+	}
+	if user.Role == "" {
+		user.Role = model.RoleCustomer
+	}
+	d.users[user.UserID] = user
+	return user
+}
+
+// 注文を追加する (OrderIDが0の場合は採番する)
+// 配送状況や日時を指定したテストデータの投入に使う
+func (m *MemoryDB) AddOrder(order model.Order) model.Order {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.data
+	if order.OrderID == 0 {
+		order.OrderID = d.nextOrderID
+	}
+	if order.OrderID >= d.nextOrderID {
+		d.nextOrderID = order.OrderID + 1
+	}
+	if order.ShippedStatus == "" {
+		order.ShippedStatus = "shipping"
+	}
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+	d.orders[order.OrderID] = order
+	return order
+}
+
+// MemoryDBを使うStore
+// ログイン試行回数はLoginAttemptRepositoryのメモリフォールバックで管理する
+// ExecTxのfn内で外側のStoreを使うとロック待ちになるため、必ずtxStoreを使うこと
+func NewMemoryStore(m *MemoryDB) *Store {
+	s := newMemoryStore(m.view, NewLoginAttemptRepository(nil), newMemoryOrderEvents())
+	s.beginTx = func(ctx context.Context, fn func(txStore *Store) error) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data := m.data.clone()
+		view := func(f func(d *memoryData) error) error { return f(data) }
+		if err := fn(newMemoryStore(view, s.LoginAttemptRepo, s.OrderEventRepo)); err != nil {
+			return err
+		}
+		m.data = data
+		return nil
+	}
+	return s
+}
+
+func newMemoryStore(view memoryView, attempts LoginAttempts, events OrderEvents) *Store {
+	return &Store{
+		UserRepo:    &memoryUsers{view: view},
+		SessionRepo: &memorySessions{view: view},
+		ProductRepo: &memoryProducts{view: view},
+		OrderRepo:   &memoryOrders{view: view},
+		OutboxRepo:  &memoryOutbox{view: view},
+		WebhookRepo: &memoryWebhooks{view: view},
+
+		LoginAttemptRepo: attempts,
+		OrderEventRepo:   events,
+	}
+}
+
+// データを読み書きする関数 (トランザクション外ではロックを取り、トランザクション内ではそのコピーを渡す)
+type memoryView func(f func(d *memoryData) error) error
+
+func (m *MemoryDB) view(f func(d *memoryData) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return f(m.data)
+}
+
+type memoryUsers struct {
+	view memoryView
+}
+
+func (r *memoryUsers) FindByUserName(ctx context.Context, userName string) (*model.User, error) {
+	var found *model.User
+	err := r.view(func(d *memoryData) error {
+		for _, u := range d.users {
+			if u.UserName == userName {
+				found = &u
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return found, err
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *model.User) (int, error) {
+	var id int
+	err := r.view(func(d *memoryData) error {
+		id = d.nextUserID
+		d.nextUserID++
+		u := *user
+		u.UserID = id
+		d.users[id] = u
+		return nil
+	})
+	return id, err
+}
+
+type memorySessions struct {
+	view memoryView
+}
+
+func (r *memorySessions) Create(ctx context.Context, userID int, duration time.Duration) (string, time.Time, error) {
+	sessionUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	sessionID := sessionUUID.String()
+	expiresAt := time.Now().Add(duration)
+	err = r.view(func(d *memoryData) error {
+		d.sessions[sessionID] = memorySession{userID: userID, expiresAt: expiresAt}
+		return nil
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return sessionID, expiresAt, nil
+}
+
+func (r *memorySessions) FindUserBySessionID(ctx context.Context, sessionID string) (*model.SessionUser, error) {
+	var found *model.SessionUser
+	err := r.view(func(d *memoryData) error {
+		s, ok := d.sessions[sessionID]
+		if !ok || !s.expiresAt.After(time.Now()) {
+			return sql.ErrNoRows
+		}
+		u, ok := d.users[s.userID]
+		if !ok {
+			return sql.ErrNoRows
+		}
+		found = &model.SessionUser{UserID: u.UserID, Role: u.Role}
+		return nil
+	})
+	return found, err
+}
+
+type memoryProducts struct {
+	view memoryView
+}
+
+// 検索はMySQLの全文検索の代わりに、商品名・説明の部分一致(大文字小文字を区別しない)で行う
+func (r *memoryProducts) ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error) {
+	var products []model.Product
+	err := r.view(func(d *memoryData) error {
+		search := strings.ToLower(req.Search)
+		for _, p := range d.products {
+			if p.deleted {
+				continue
+			}
+			if search != "" &&
+				!strings.Contains(strings.ToLower(p.Name), search) &&
+				!strings.Contains(strings.ToLower(p.Description), search) {
+				continue
+			}
+			products = append(products, p.Product)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var compare func(a, b model.Product) int
+	switch req.SortField {
+	case "name":
+		compare = func(a, b model.Product) int { return strings.Compare(a.Name, b.Name) }
+	case "value":
+		compare = func(a, b model.Product) int { return cmp.Compare(a.Value, b.Value) }
+	case "weight":
+		compare = func(a, b model.Product) int { return cmp.Compare(a.Weight, b.Weight) }
+	default:
+		compare = func(a, b model.Product) int { return cmp.Compare(a.ProductID, b.ProductID) }
+	}
+	desc := strings.EqualFold(req.SortOrder, "DESC")
+	slices.SortFunc(products, func(a, b model.Product) int {
+		c := compare(a, b)
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ProductID, b.ProductID)
+		}
+		return c
+	})
+
+	total := len(products)
+	return paginate(products, req), total, nil
+}
+
+func (r *memoryProducts) FindByID(ctx context.Context, productID int) (*model.Product, error) {
+	var found *model.Product
+	err := r.view(func(d *memoryData) error {
+		p, ok := d.products[productID]
+		if !ok || p.deleted {
+			return sql.ErrNoRows
+		}
+		found = &p.Product
+		return nil
+	})
+	return found, err
+}
+
+func (r *memoryProducts) CountActive(ctx context.Context, productIDs []int) (int, error) {
+	count := 0
+	err := r.view(func(d *memoryData) error {
+		// IN句と同様に重複したIDは1件として数える
+		seen := make(map[int]struct{}, len(productIDs))
+		for _, id := range productIDs {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			if p, ok := d.products[id]; ok && !p.deleted {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (r *memoryProducts) Create(ctx context.Context, input model.ProductInput) (int, error) {
+	var id int
+	err := r.view(func(d *memoryData) error {
+		id = d.nextProductID
+		d.nextProductID++
+		d.products[id] = memoryProduct{Product: productFromInput(id, input)}
+		return nil
+	})
+	return id, err
+}
+
+func (r *memoryProducts) Update(ctx context.Context, productID int, input model.ProductInput) error {
+	return r.view(func(d *memoryData) error {
+		p, ok := d.products[productID]
+		if !ok || p.deleted {
+			return sql.ErrNoRows
+		}
+		p.Product = productFromInput(productID, input)
+		d.products[productID] = p
+		return nil
+	})
+}
+
+func (r *memoryProducts) UpdateImage(ctx context.Context, productID int, imagePath string) error {
+	return r.view(func(d *memoryData) error {
+		p, ok := d.products[productID]
+		if !ok || p.deleted {
+			return sql.ErrNoRows
+		}
+		p.Image = imagePath
+		d.products[productID] = p
+		return nil
+	})
+}
+
+func (r *memoryProducts) SoftDelete(ctx context.Context, productID int) error {
+	return r.view(func(d *memoryData) error {
+		p, ok := d.products[productID]
+		if !ok || p.deleted {
+			return sql.ErrNoRows
+		}
+		p.deleted = true
+		d.products[productID] = p
+		return nil
+	})
+}
+
+func productFromInput(id int, input model.ProductInput) model.Product {
+	return model.Product{
+		ProductID:   id,
+		Name:        input.Name,
+		Value:       input.Value,
+		Weight:      input.Weight,
+		Image:       input.Image,
+		Description: input.Description,
+	}
+}
+
+type memoryOrders struct {
+	view memoryView
+}
+
+func (r *memoryOrders) Create(ctx context.Context, order *model.Order) (string, error) {
+	ids, err := r.CreateBulk(ctx, []model.Order{*order})
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// MySQLと同様に連続した注文IDを採番する
+// 商品の存在は確認しない (外部キー制約はないため)
+func (r *memoryOrders) CreateBulk(ctx context.Context, orders []model.Order) ([]string, error) {
+	ids := make([]string, 0, len(orders))
+	err := r.view(func(d *memoryData) error {
+		now := time.Now()
+		for _, o := range orders {
+			id := d.nextOrderID
+			d.nextOrderID++
+			d.orders[id] = model.Order{
+				OrderID:       id,
+				UserID:        o.UserID,
+				ProductID:     o.ProductID,
+				ShippedStatus: "shipping",
+				CreatedAt:     now,
+			}
+			ids = append(ids, fmt.Sprintf("%d", id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *memoryOrders) Import(ctx context.Context, orders []model.Order) error {
+	return r.view(func(d *memoryData) error {
+		for _, o := range orders {
+			id := d.nextOrderID
+			d.nextOrderID++
+			d.orders[id] = model.Order{
+				OrderID:       id,
+				UserID:        o.UserID,
+				ProductID:     o.ProductID,
+				ShippedStatus: o.ShippedStatus,
+				CreatedAt:     o.CreatedAt,
+				ArrivedAt:     o.ArrivedAt,
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryOrders) UpdateStatuses(ctx context.Context, orderIDs []int64, newStatus string) error {
+	return r.view(func(d *memoryData) error {
+		for _, id := range orderIDs {
+			if o, ok := d.orders[id]; ok {
+				o.ShippedStatus = newStatus
+				d.orders[id] = o
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryOrders) ResetStatuses(ctx context.Context, fromStatus, toStatus string) (int64, error) {
+	var n int64
+	err := r.view(func(d *memoryData) error {
+		for id, o := range d.orders {
+			if o.ShippedStatus == fromStatus {
+				o.ShippedStatus = toStatus
+				d.orders[id] = o
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (r *memoryOrders) FindUserIDs(ctx context.Context, orderIDs []int64) (map[int64]int, error) {
+	userIDs := make(map[int64]int, len(orderIDs))
+	err := r.view(func(d *memoryData) error {
+		for _, id := range orderIDs {
+			if o, ok := d.orders[id]; ok {
+				userIDs[id] = o.UserID
+			}
+		}
+		return nil
+	})
+	return userIDs, err
+}
+
+// MySQLの実装と同様に、注文ID・重さ・価値のみを返す
+func (r *memoryOrders) GetShippingOrders(ctx context.Context) ([]model.Order, error) {
+	var orders []model.Order
+	err := r.view(func(d *memoryData) error {
+		for _, o := range d.orders {
+			p, ok := d.products[o.ProductID]
+			if !ok || o.ShippedStatus != "shipping" {
+				continue
+			}
+			orders = append(orders, model.Order{OrderID: o.OrderID, Weight: p.Weight, Value: p.Value})
+		}
+		return nil
+	})
+	slices.SortFunc(orders, func(a, b model.Order) int { return cmp.Compare(a.OrderID, b.OrderID) })
+	return orders, err
+}
+
+func (r *memoryOrders) ListOrders(ctx context.Context, userID int, req model.ListRequest) ([]model.Order, int, error) {
+	var orders []model.Order
+	err := r.view(func(d *memoryData) error {
+		for _, o := range d.orders {
+			p, ok := d.products[o.ProductID]
+			if !ok || o.UserID != userID {
+				continue
+			}
+			if req.Search != "" {
+				if req.Type == "prefix" && !strings.HasPrefix(p.Name, req.Search) {
+					continue
+				}
+				if req.Type != "prefix" && !strings.Contains(p.Name, req.Search) {
+					continue
+				}
+			}
+			orders = append(orders, model.Order{
+				OrderID:       o.OrderID,
+				ProductID:     o.ProductID,
+				ProductName:   p.Name,
+				ShippedStatus: o.ShippedStatus,
+				CreatedAt:     o.CreatedAt,
+				ArrivedAt:     o.ArrivedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var compare func(a, b model.Order) int
+	switch req.SortField {
+	case "product_name":
+		compare = func(a, b model.Order) int { return strings.Compare(a.ProductName, b.ProductName) }
+	case "created_at":
+		compare = func(a, b model.Order) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "shipped_status":
+		compare = func(a, b model.Order) int { return strings.Compare(a.ShippedStatus, b.ShippedStatus) }
+	case "arrived_at":
+		// MySQLと同様にNULLは最小として扱う
+		compare = func(a, b model.Order) int {
+			if a.ArrivedAt.Valid != b.ArrivedAt.Valid {
+				if a.ArrivedAt.Valid {
+					return 1
+				}
+				return -1
+			}
+			return a.ArrivedAt.Time.Compare(b.ArrivedAt.Time)
+		}
+	default:
+		compare = func(a, b model.Order) int { return cmp.Compare(a.OrderID, b.OrderID) }
+	}
+	desc := strings.EqualFold(req.SortOrder, "DESC")
+	slices.SortFunc(orders, func(a, b model.Order) int {
+		c := compare(a, b)
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.OrderID, b.OrderID)
+		}
+		return c
+	})
+
+	total := len(orders)
+	return paginate(orders, req), total, nil
+}
+
+func (r *memoryOrders) EachOrder(ctx context.Context, userID int, req model.ListRequest, fn func(model.Order) error) error {
+	req.PageSize = 0
+	orders, _, err := r.ListOrders(ctx, userID, req)
+	if err != nil {
+		return err
+	}
+	// MySQLのカーソルと同様に、ctxがキャンセルされたらそこで止める
+	for _, o := range orders {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PageSizeとOffsetで切り出す (PageSizeが0以下の場合は全件)
+func paginate[T any](items []T, req model.ListRequest) []T {
+	if req.PageSize <= 0 {
+		return items
+	}
+	start := min(max(req.Offset, 0), len(items))
+	end := min(start+req.PageSize, len(items))
+	return items[start:end]
+}
+
+type memoryOutbox struct {
+	view memoryView
+}
+
+func (r *memoryOutbox) Add(ctx context.Context, events []model.OutboxEvent) error {
+	return r.view(func(d *memoryData) error {
+		for _, e := range events {
+			e.ID = d.nextOutboxID
+			e.NextAttemptAt = sql.NullTime{Time: e.CreatedAt, Valid: true}
+			d.nextOutboxID++
+			d.outbox = append(d.outbox, e)
+		}
+		return nil
+	})
+}
+
+// トランザクション中は他の読み書きを待たせるため、ロックは不要
+func (r *memoryOutbox) ClaimPending(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	err := r.view(func(d *memoryData) error {
+		for i := range d.outbox {
+			if len(events) >= limit {
+				break
+			}
+			if e := &d.outbox[i]; e.NextAttemptAt.Valid && !e.NextAttemptAt.Time.After(now) {
+				e.Attempts++
+				e.NextAttemptAt.Time = now.Add(lease)
+				events = append(events, *e)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (r *memoryOutbox) MarkPublished(ctx context.Context, ids []int64, at time.Time) error {
+	return r.update(ids, func(e *model.OutboxEvent) {
+		e.PublishedAt = sql.NullTime{Time: at, Valid: true}
+		e.NextAttemptAt = sql.NullTime{}
+		e.LastError = sql.NullString{}
+	})
+}
+
+func (r *memoryOutbox) RetryLater(ctx context.Context, ids []int64, nextAt time.Time, reason string) error {
+	return r.update(ids, func(e *model.OutboxEvent) {
+		e.NextAttemptAt = sql.NullTime{Time: nextAt, Valid: true}
+		e.LastError = sql.NullString{String: reason, Valid: true}
+	})
+}
+
+func (r *memoryOutbox) MarkFailed(ctx context.Context, ids []int64, reason string) error {
+	return r.update(ids, func(e *model.OutboxEvent) {
+		e.NextAttemptAt = sql.NullTime{}
+		e.LastError = sql.NullString{String: reason, Valid: true}
+	})
+}
+
+func (r *memoryOutbox) update(ids []int64, f func(e *model.OutboxEvent)) error {
+	return r.view(func(d *memoryData) error {
+		for i := range d.outbox {
+			if slices.Contains(ids, d.outbox[i].ID) {
+				f(&d.outbox[i])
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryOutbox) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.view(func(d *memoryData) error {
+		d.outbox = slices.DeleteFunc(d.outbox, func(e model.OutboxEvent) bool {
+			if e.PublishedAt.Valid && e.PublishedAt.Time.Before(before) {
+				n++
+				return true
+			}
+			return false
+		})
+		return nil
+	})
+	return n, err
+}
+
+// 送信先のURLとSecretは、取得時に登録から補う
+type memoryWebhooks struct {
+	view memoryView
+}
+
+func (r *memoryWebhooks) CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) (int64, error) {
+	var id int64
+	err := r.view(func(d *memoryData) error {
+		id = d.nextWebhookID
+		d.nextWebhookID++
+		s := *sub
+		s.ID = id
+		s.EventTypes = slices.Clone(sub.EventTypes)
+		d.webhooks[id] = s
+		return nil
+	})
+	return id, err
+}
+
+func (r *memoryWebhooks) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	var subs []model.WebhookSubscription
+	err := r.view(func(d *memoryData) error {
+		subs = slices.Collect(maps.Values(d.webhooks))
+		return nil
+	})
+	slices.SortFunc(subs, func(a, b model.WebhookSubscription) int { return cmp.Compare(a.ID, b.ID) })
+	return subs, err
+}
+
+func (r *memoryWebhooks) DeleteSubscription(ctx context.Context, id int64) error {
+	return r.view(func(d *memoryData) error {
+		if _, ok := d.webhooks[id]; !ok {
+			return sql.ErrNoRows
+		}
+		delete(d.webhooks, id)
+		d.deliveries = slices.DeleteFunc(d.deliveries, func(dl memoryDelivery) bool { return dl.SubscriptionID == id })
+		d.deadLetters = slices.DeleteFunc(d.deadLetters, func(dl model.WebhookDeadLetter) bool { return dl.SubscriptionID == id })
+		return nil
+	})
+}
+
+func (r *memoryWebhooks) Enqueue(ctx context.Context, events []model.OutboxEvent, now time.Time) (int, error) {
+	subs, err := r.ListSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = r.view(func(d *memoryData) error {
+		for _, e := range events {
+			body, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			for _, sub := range subs {
+				if !slices.Contains(sub.EventTypes, e.EventType) || d.findDelivery(sub.ID, e.EventID) >= 0 {
+					continue
+				}
+				d.deliveries = append(d.deliveries, memoryDelivery{
+					WebhookDelivery: model.WebhookDelivery{
+						ID:             d.nextDeliveryID,
+						SubscriptionID: sub.ID,
+						EventID:        e.EventID,
+						EventType:      e.EventType,
+						Body:           body,
+						CreatedAt:      now,
+					},
+					nextAttemptAt: now,
+				})
+				d.nextDeliveryID++
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (d *memoryData) findDelivery(subscriptionID int64, eventID string) int {
+	return slices.IndexFunc(d.deliveries, func(dl memoryDelivery) bool {
+		return dl.SubscriptionID == subscriptionID && dl.EventID == eventID
+	})
+}
+
+func (r *memoryWebhooks) ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	var claimed []model.WebhookDelivery
+	err := r.view(func(d *memoryData) error {
+		due := make([]int, 0)
+		for i, dl := range d.deliveries {
+			if !dl.nextAttemptAt.After(now) {
+				due = append(due, i)
+			}
+		}
+		slices.SortStableFunc(due, func(a, b int) int {
+			return d.deliveries[a].nextAttemptAt.Compare(d.deliveries[b].nextAttemptAt)
+		})
+		for _, i := range due[:min(limit, len(due))] {
+			dl := &d.deliveries[i]
+			dl.nextAttemptAt = now.Add(lease)
+			delivery := dl.WebhookDelivery
+			sub := d.webhooks[dl.SubscriptionID]
+			delivery.URL, delivery.Secret = sub.URL, sub.Secret
+			claimed = append(claimed, delivery)
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+func (r *memoryWebhooks) DeleteDelivery(ctx context.Context, id int64) error {
+	return r.view(func(d *memoryData) error {
+		d.deliveries = slices.DeleteFunc(d.deliveries, func(dl memoryDelivery) bool { return dl.ID == id })
+		return nil
+	})
+}
+
+func (r *memoryWebhooks) RetryDelivery(ctx context.Context, id int64, nextAt time.Time, reason string) error {
+	return r.view(func(d *memoryData) error {
+		for i := range d.deliveries {
+			if dl := &d.deliveries[i]; dl.ID == id {
+				dl.Attempts++
+				dl.nextAttemptAt = nextAt
+				dl.lastError = reason
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryWebhooks) DeadLetter(ctx context.Context, id int64, reason string, now time.Time) error {
+	return r.view(func(d *memoryData) error {
+		i := slices.IndexFunc(d.deliveries, func(dl memoryDelivery) bool { return dl.ID == id })
+		if i < 0 {
+			return nil
+		}
+		dl := d.deliveries[i]
+		d.deadLetters = append(d.deadLetters, model.WebhookDeadLetter{
+			ID:             d.nextDeliveryID,
+			SubscriptionID: dl.SubscriptionID,
+			EventID:        dl.EventID,
+			EventType:      dl.EventType,
+			Body:           dl.Body,
+			Attempts:       dl.Attempts + 1,
+			LastError:      reason,
+			CreatedAt:      dl.CreatedAt,
+			FailedAt:       now,
+		})
+		d.nextDeliveryID++
+		d.deliveries = slices.Delete(d.deliveries, i, i+1)
+		return nil
+	})
+}
+
+func (r *memoryWebhooks) ListDeadLetters(ctx context.Context, subscriptionID int64, limit int) ([]model.WebhookDeadLetter, error) {
+	var deadLetters []model.WebhookDeadLetter
+	err := r.view(func(d *memoryData) error {
+		for i := len(d.deadLetters) - 1; i >= 0 && len(deadLetters) < limit; i-- {
+			if dl := d.deadLetters[i]; dl.SubscriptionID == subscriptionID {
+				deadLetters = append(deadLetters, dl)
+			}
+		}
+		return nil
+	})
+	return deadLetters, err
+}
+
+func (r *memoryWebhooks) Replay(ctx context.Context, subscriptionID int64, ids []int64, now time.Time) (int64, error) {
+	var n int64
+	err := r.view(func(d *memoryData) error {
+		d.deadLetters = slices.DeleteFunc(d.deadLetters, func(dl model.WebhookDeadLetter) bool {
+			if dl.SubscriptionID != subscriptionID || (len(ids) > 0 && !slices.Contains(ids, dl.ID)) {
+				return false
+			}
+			if i := d.findDelivery(dl.SubscriptionID, dl.EventID); i >= 0 {
+				d.deliveries[i].nextAttemptAt = now
+			} else {
+				d.deliveries = append(d.deliveries, memoryDelivery{
+					WebhookDelivery: model.WebhookDelivery{
+						ID:             d.nextDeliveryID,
+						SubscriptionID: dl.SubscriptionID,
+						EventID:        dl.EventID,
+						EventType:      dl.EventType,
+						Body:           dl.Body,
+						CreatedAt:      dl.CreatedAt,
+					},
+					nextAttemptAt: now,
+				})
+				d.nextDeliveryID++
+			}
+			n++
+			return true
+		})
+		return nil
+	})
+	return n, err
+}
+
+// プロセス内で配信する注文イベント (IDは"0-<連番>")
+type memoryOrderEvents struct {
+	mu      sync.Mutex
+	seq     uint64
+	history map[int][]model.OrderEvent
+	subs    map[int]map[chan model.OrderEvent]struct{}
+}
+
+func newMemoryOrderEvents() *memoryOrderEvents {
+	return &memoryOrderEvents{
+		history: make(map[int][]model.OrderEvent),
+		subs:    make(map[int]map[chan model.OrderEvent]struct{}),
+	}
+}
+
+// 購読者の受信が追いつかない場合、Redisの実装と同様にイベントを捨てる
+func (r *memoryOrderEvents) Publish(ctx context.Context, events []model.OrderEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range events {
+		r.seq++
+		e.ID = fmt.Sprintf("0-%d", r.seq)
+		history := append(r.history[e.UserID], e)
+		if len(history) > orderEventHistory {
+			history = history[len(history)-orderEventHistory:]
+		}
+		r.history[e.UserID] = history
+		for ch := range r.subs[e.UserID] {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memoryOrderEvents) Subscribe(ctx context.Context, userID int, lastEventID string) (<-chan model.OrderEvent, error) {
+	live := make(chan model.OrderEvent, 100)
+	r.mu.Lock()
+	var backlog []model.OrderEvent
+	if lastEventID != "" {
+		for _, e := range r.history[userID] {
+			if CompareEventIDs(e.ID, lastEventID) > 0 {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	if r.subs[userID] == nil {
+		r.subs[userID] = make(map[chan model.OrderEvent]struct{})
+	}
+	r.subs[userID][live] = struct{}{}
+	r.mu.Unlock()
+
+	out := make(chan model.OrderEvent)
+	go func() {
+		defer close(out)
+		defer func() {
+			r.mu.Lock()
+			delete(r.subs[userID], live)
+			r.mu.Unlock()
+		}()
+		for _, e := range backlog {
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case e := <-live:
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
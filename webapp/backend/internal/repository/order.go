@@ -12,10 +12,12 @@ import (
 
 type OrderRepository struct {
 	db DBTX
+	// 注文履歴の取得に使う (レプリカがある場合はreplicaDB、ない場合はdbと同じ)
+	read DBTX
 }
 
 func NewOrderRepository(db DBTX) *OrderRepository {
-	return &OrderRepository{db: db}
+	return &OrderRepository{db: db, read: db}
 }
 
 // 注文を作成し、生成された注文IDを返す
@@ -77,6 +79,26 @@ func (r *OrderRepository) CreateBulk(ctx context.Context, orders []model.Order)
 	return orderIDs, nil
 }
 
+// ステータスと日時を指定して注文を一括で挿入する
+// テストデータの投入(seedコマンド)に使う。注文IDは採番に任せる
+func (r *OrderRepository) Import(ctx context.Context, orders []model.Order) error {
+	const batchSize = 1000
+	for start := 0; start < len(orders); start += batchSize {
+		batch := orders[start:min(start+batchSize, len(orders))]
+		query := `INSERT INTO orders (user_id, product_id, shipped_status, created_at, arrived_at) VALUES `
+		args := make([]interface{}, 0, len(batch)*5)
+		placeholders := make([]string, 0, len(batch))
+		for _, o := range batch {
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+			args = append(args, o.UserID, o.ProductID, o.ShippedStatus, o.CreatedAt, o.ArrivedAt)
+		}
+		if _, err := r.db.ExecContext(ctx, query+strings.Join(placeholders, ", "), args...); err != nil {
+			return fmt.Errorf("failed to import orders: %w", err)
+		}
+	}
+	return nil
+}
+
 // 複数の注文IDのステータスを一括で更新
 // 主に配送ロボットが注文を引き受けた際に一括更新をするために使用
 func (r *OrderRepository) UpdateStatuses(ctx context.Context, orderIDs []int64, newStatus string) error {
@@ -92,6 +114,39 @@ func (r *OrderRepository) UpdateStatuses(ctx context.Context, orderIDs []int64,
 	return err
 }
 
+// 指定したステータスの注文をすべて別のステータスに戻し、更新件数を返す
+// 運用コマンド(reset-orders)から使用
+func (r *OrderRepository) ResetStatuses(ctx context.Context, fromStatus, toStatus string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE orders SET shipped_status = ? WHERE shipped_status = ?", toStatus, fromStatus)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 注文IDごとの注文者を取得 (存在しない注文は含まない)
+func (r *OrderRepository) FindUserIDs(ctx context.Context, orderIDs []int64) (map[int64]int, error) {
+	userIDs := make(map[int64]int, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return userIDs, nil
+	}
+	query, args, err := sqlx.In("SELECT order_id, user_id FROM orders WHERE order_id IN (?)", orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		OrderID int64 `db:"order_id"`
+		UserID  int   `db:"user_id"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		userIDs[row.OrderID] = row.UserID
+	}
+	return userIDs, nil
+}
+
 // 配送中(shipped_status:shipping)の注文一覧を取得
 func (r *OrderRepository) GetShippingOrders(ctx context.Context) ([]model.Order, error) {
 	var orders []model.Order
@@ -111,49 +166,14 @@ func (r *OrderRepository) GetShippingOrders(ctx context.Context) ([]model.Order,
 // 注文履歴一覧を取得 (DB側でソート、フィルタ、Offset/Limitを実行)
 func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.ListRequest) ([]model.Order, int, error) {
 
-	// --- 1. ソート順の決定 ---
-	// SQLインジェクション防止のため、ソート可能な列をホワイトリストで管理
-	sortFieldMap := map[string]string{
-		"order_id":       "o.order_id",
-		"product_name":   "p.name",
-		"created_at":     "o.created_at",
-		"shipped_status": "o.shipped_status",
-		"arrived_at":     "o.arrived_at",
-	}
-
-	sortColumn, ok := sortFieldMap[req.SortField]
-	if !ok {
-		sortColumn = "o.order_id" // デフォルトのソート列
-	}
-
-	sortOrder := "ASC "
-	if strings.ToUpper(req.SortOrder) == "DESC" {
-		sortOrder = "DESC "
-	}
-
-	// --- 2. フィルタリング条件の構築 (総件数クエリとメインクエリで共用) ---
-	whereClauses := []string{"o.user_id = ?"}
+	// --- 1. フィルタリング条件の構築 (総件数クエリとメインクエリで共用) ---
+	whereQuery, whereArgs := orderListWhere(userID, req)
 	// メインクエリ用の引数リスト
-	args := []interface{}{userID}
+	args := append([]interface{}{}, whereArgs...)
 	// COUNTクエリ用の引数リスト (LIMIT/OFFSETを含まないため別管理)
-	countArgs := []interface{}{userID}
+	countArgs := whereArgs
 
-	if req.Search != "" {
-		var searchPattern string
-		if req.Type == "prefix" {
-			searchPattern = req.Search + "%"
-		} else {
-			// デフォルトは "contains"
-			searchPattern = "%" + req.Search + "%"
-		}
-		whereClauses = append(whereClauses, "p.name LIKE ?")
-		args = append(args, searchPattern)
-		countArgs = append(countArgs, searchPattern)
-	}
-
-	whereQuery := strings.Join(whereClauses, " AND ")
-
-	// --- 3. 総件数(total)の取得クエリ (フィルタ条件を適用) ---
+	// --- 2. 総件数(total)の取得クエリ (フィルタ条件を適用) ---
 	countQuery := `
 		SELECT COUNT(*)
 		FROM orders o
@@ -161,22 +181,69 @@ func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.
 		WHERE ` + whereQuery
 
 	var total int
-	countQueryRebound := r.db.Rebind(countQuery)
+	countQueryRebound := r.read.Rebind(countQuery)
 	// COUNTクエリには countArgs を使用
-	if err := r.db.GetContext(ctx, &total, countQueryRebound, countArgs...); err != nil {
+	if err := r.read.GetContext(ctx, &total, countQueryRebound, countArgs...); err != nil {
 		return nil, 0, fmt.Errorf("failed to count orders: %w", err)
 	}
 
-	// --- 4. メインクエリの構築 (ORDER BY, LIMIT, OFFSET) ---
+	// --- 3. メインクエリの構築 (ORDER BY, LIMIT, OFFSET) ---
+	query := orderListSelect + whereQuery + `
+		` + orderListOrderBy(req)
 
-	var orderByClause string
-	if sortColumn == "o.order_id" {
-		orderByClause = fmt.Sprintf(" ORDER BY %s %s ", sortColumn, sortOrder)
-	} else {
-		orderByClause = fmt.Sprintf(" ORDER BY %s %s, o.order_id ASC ", sortColumn, sortOrder)
+	if req.PageSize > 0 {
+		query += `LIMIT ? OFFSET ?`
+		args = append(args, req.PageSize, req.Offset)
 	}
 
-	query := `
+	// --- 4. クエリ実行とマッピング ---
+	var ordersRaw []orderListRow
+	queryRebound := r.read.Rebind(query)
+	// メインクエリには args を使用
+	if err := r.read.SelectContext(ctx, &ordersRaw, queryRebound, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to list orders: %w", err)
+	}
+
+	// --- 5. 結果のマッピング ---
+	// メモリ上でのフィルタリングやソート、スライス操作はすべて不要
+	orders := make([]model.Order, 0, len(ordersRaw))
+	for _, o := range ordersRaw {
+		orders = append(orders, o.toModel())
+	}
+
+	// DBから取得した件数(pagedOrders)と、フィルタ条件に合う総件数(total)を返す
+	return orders, total, nil
+}
+
+// ListOrdersと同じ条件・順序の注文履歴を、1件ずつfnに渡す (ページングはしない)
+// 結果をまとめて読み込まず、カーソルから読みながら渡すため、件数によらずメモリ使用量は一定
+// fnがエラーを返した場合はそこで止め、そのエラーを返す
+func (r *OrderRepository) EachOrder(ctx context.Context, userID int, req model.ListRequest, fn func(model.Order) error) error {
+	whereQuery, args := orderListWhere(userID, req)
+	query := orderListSelect + whereQuery + `
+		` + orderListOrderBy(req)
+
+	rows, err := r.read.QueryxContext(ctx, r.read.Rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o orderListRow
+		if err := rows.StructScan(&o); err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+		if err := fn(o.toModel()); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read orders: %w", err)
+	}
+	return nil
+}
+
+const orderListSelect = `
 		SELECT 
 			o.order_id, 
 			o.product_id, 
@@ -186,47 +253,71 @@ func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.
 			p.name AS product_name
 		FROM orders o
 		JOIN products p ON o.product_id = p.product_id
-		WHERE ` + whereQuery + `
-		` + orderByClause
+		WHERE `
+
+type orderListRow struct {
+	OrderID       int          `db:"order_id"`
+	ProductID     int          `db:"product_id"`
+	ShippedStatus string       `db:"shipped_status"`
+	CreatedAt     sql.NullTime `db:"created_at"`
+	ArrivedAt     sql.NullTime `db:"arrived_at"`
+	ProductName   string       `db:"product_name"`
+}
 
-	if req.PageSize > 0 {
-		query += `LIMIT ? OFFSET ?`
-		args = append(args, req.PageSize, req.Offset)
+func (o orderListRow) toModel() model.Order {
+	return model.Order{
+		OrderID:       int64(o.OrderID),
+		ProductID:     o.ProductID,
+		ProductName:   o.ProductName,
+		ShippedStatus: o.ShippedStatus,
+		CreatedAt:     o.CreatedAt.Time, // NullTimeからTimeへ
+		ArrivedAt:     o.ArrivedAt,
 	}
+}
 
-	// --- 5. クエリ実行とマッピング ---
-	// ( ... これ以降のロジックは変更なし )
-	// --- 5. クエリ実行とマッピング ---
-	type orderRow struct {
-		OrderID       int          `db:"order_id"`
-		ProductID     int          `db:"product_id"`
-		ShippedStatus string       `db:"shipped_status"`
-		CreatedAt     sql.NullTime `db:"created_at"`
-		ArrivedAt     sql.NullTime `db:"arrived_at"`
-		ProductName   string       `db:"product_name"`
+// 注文履歴のWHERE句と引数 (ユーザーと商品名の検索)
+func orderListWhere(userID int, req model.ListRequest) (string, []interface{}) {
+	whereClauses := []string{"o.user_id = ?"}
+	args := []interface{}{userID}
+
+	if req.Search != "" {
+		var searchPattern string
+		if req.Type == "prefix" {
+			searchPattern = req.Search + "%"
+		} else {
+			// デフォルトは "contains"
+			searchPattern = "%" + req.Search + "%"
+		}
+		whereClauses = append(whereClauses, "p.name LIKE ?")
+		args = append(args, searchPattern)
 	}
 
-	var ordersRaw []orderRow
-	queryRebound := r.db.Rebind(query)
-	// メインクエリには args を使用
-	if err := r.db.SelectContext(ctx, &ordersRaw, queryRebound, args...); err != nil {
-		return nil, 0, fmt.Errorf("failed to list orders: %w", err)
+	return strings.Join(whereClauses, " AND "), args
+}
+
+// 注文履歴のORDER BY句 (同じ値の場合は注文ID順)
+func orderListOrderBy(req model.ListRequest) string {
+	// SQLインジェクション防止のため、ソート可能な列をホワイトリストで管理
+	sortFieldMap := map[string]string{
+		"order_id":       "o.order_id",
+		"product_name":   "p.name",
+		"created_at":     "o.created_at",
+		"shipped_status": "o.shipped_status",
+		"arrived_at":     "o.arrived_at",
 	}
 
-	// --- 6. 結果のマッピング ---
-	// メモリ上でのフィルタリングやソート、スライス操作はすべて不要
-	orders := make([]model.Order, 0, len(ordersRaw))
-	for _, o := range ordersRaw {
-		orders = append(orders, model.Order{
-			OrderID:       int64(o.OrderID),
-			ProductID:     o.ProductID,
-			ProductName:   o.ProductName,
-			ShippedStatus: o.ShippedStatus,
-			CreatedAt:     o.CreatedAt.Time, // NullTimeからTimeへ
-			ArrivedAt:     o.ArrivedAt,
-		})
+	sortColumn, ok := sortFieldMap[req.SortField]
+	if !ok {
+		sortColumn = "o.order_id" // デフォルトのソート列
 	}
 
-	// DBから取得した件数(pagedOrders)と、フィルタ条件に合う総件数(total)を返す
-	return orders, total, nil
+	sortOrder := "ASC "
+	if strings.ToUpper(req.SortOrder) == "DESC" {
+		sortOrder = "DESC "
+	}
+
+	if sortColumn == "o.order_id" {
+		return fmt.Sprintf(" ORDER BY %s %s ", sortColumn, sortOrder)
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, o.order_id ASC ", sortColumn, sortOrder)
 }
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"backend/internal/logging"
+	"backend/internal/model"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ユーザーごとに保持するイベント数の上限 (これより古いイベントはLast-Event-IDで再送できない)
+	orderEventHistory = 1000
+	// 最後のイベントから履歴を保持する期間
+	orderEventTTL = 24 * time.Hour
+)
+
+// 注文ステータスの変更イベントを配信する
+// ユーザーごとのRedis Streamに履歴を残し、Pub/Subで全サーバーの購読者に配信する
+type OrderEventRepository struct {
+	rdb *redis.Client
+}
+
+func NewOrderEventRepository(rdb *redis.Client) *OrderEventRepository {
+	return &OrderEventRepository{rdb: rdb}
+}
+
+// Streamのキーと、Pub/Subのチャンネル名
+func orderEventKey(userID int) string {
+	return "orders:events:" + strconv.Itoa(userID)
+}
+
+// イベントを履歴に追加してから配信する
+func (r *OrderEventRepository) Publish(ctx context.Context, events []model.OrderEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	adds := make([]*redis.StringCmd, len(events))
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			key := orderEventKey(e.UserID)
+			adds[i] = pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: key,
+				MaxLen: orderEventHistory,
+				Approx: true,
+				Values: map[string]interface{}{"data": data},
+			})
+			pipe.Expire(ctx, key, orderEventTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append order events: %w", err)
+	}
+
+	// 購読者がLast-Event-IDとして使えるよう、Streamで決まったIDを付けて配信する
+	_, err = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, e := range events {
+			e.ID = adds[i].Val()
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			pipe.Publish(ctx, orderEventKey(e.UserID), data)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish order events: %w", err)
+	}
+	return nil
+}
+
+// ユーザーのイベントを購読する
+// lastEventIDを指定した場合は、履歴からそれより後のイベントを先に送る
+// 返すチャンネルはctxがキャンセルされると閉じる
+func (r *OrderEventRepository) Subscribe(ctx context.Context, userID int, lastEventID string) (<-chan model.OrderEvent, error) {
+	key := orderEventKey(userID)
+	ps := r.rdb.Subscribe(ctx, key)
+	// 購読が始まってから履歴を読み、その間に発行されたイベントを取りこぼさないようにする
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return nil, fmt.Errorf("failed to subscribe order events: %w", err)
+	}
+
+	var backlog []model.OrderEvent
+	if lastEventID != "" {
+		msgs, err := r.rdb.XRangeN(ctx, key, "("+lastEventID, "+", orderEventHistory).Result()
+		if err != nil {
+			ps.Close()
+			return nil, fmt.Errorf("failed to read order event history: %w", err)
+		}
+		for _, msg := range msgs {
+			data, _ := msg.Values["data"].(string)
+			var e model.OrderEvent
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				logging.Warn(ctx, "skipping malformed order event", "id", msg.ID, "error", err)
+				continue
+			}
+			e.ID = msg.ID
+			backlog = append(backlog, e)
+		}
+	}
+
+	out := make(chan model.OrderEvent)
+	go func() {
+		defer close(out)
+		defer ps.Close()
+		live := ps.Channel()
+		// 履歴の読み取りより前に追加されたイベントは履歴で送っているため、Pub/Subで届いても送らない
+		sent := lastEventID
+		for _, e := range backlog {
+			sent = e.ID
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-live:
+				if !ok {
+					return
+				}
+				var e model.OrderEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+					logging.Warn(ctx, "skipping malformed order event", "error", err)
+					continue
+				}
+				if sent != "" && CompareEventIDs(e.ID, sent) <= 0 {
+					continue
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// "<ミリ秒>-<連番>"形式のイベントIDか
+func ValidEventID(id string) bool {
+	_, _, ok := parseEventID(id)
+	return ok
+}
+
+// イベントIDを発行順に比較する
+func CompareEventIDs(a, b string) int {
+	aMs, aSeq, _ := parseEventID(a)
+	bMs, bSeq, _ := parseEventID(b)
+	if c := cmp.Compare(aMs, bMs); c != 0 {
+		return c
+	}
+	return cmp.Compare(aSeq, bSeq)
+}
+
+func parseEventID(id string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
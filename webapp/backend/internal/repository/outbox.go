@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 注文の変更と同じトランザクションで記録するドメインイベント
+type OutboxRepository struct {
+	db DBTX
+}
+
+func NewOutboxRepository(db DBTX) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// イベントを記録する (変更と同じトランザクションのStoreから呼ぶ)
+func (r *OutboxRepository) Add(ctx context.Context, events []model.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	query := `INSERT INTO outbox_events (event_id, event_type, aggregate_id, payload, created_at, next_attempt_at) VALUES `
+	args := make([]interface{}, 0, len(events)*6)
+	placeholders := make([]string, 0, len(events))
+	for _, e := range events {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+		// []byteはバイナリ文字列として送られ、JSON型の列に入れられないため文字列にする
+		args = append(args, e.EventID, e.EventType, e.AggregateID, string(e.Payload), e.CreatedAt, e.CreatedAt)
+	}
+	if _, err := r.db.ExecContext(ctx, query+strings.Join(placeholders, ", "), args...); err != nil {
+		return fmt.Errorf("failed to insert outbox events: %w", err)
+	}
+	return nil
+}
+
+// 配信時刻になったイベントを記録した順に取得し、lease後まで他のリレーが取得しないようにする
+// トランザクション内で呼び、コミット後に配信する (返すイベントのAttemptsは今回の取得を含む)
+func (r *OutboxRepository) ClaimPending(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	query := `
+        SELECT id, event_id, event_type, aggregate_id, payload, created_at, published_at, next_attempt_at, attempts, last_error
+        FROM outbox_events
+        WHERE next_attempt_at <= ?
+        ORDER BY id
+        LIMIT ?
+        FOR UPDATE SKIP LOCKED
+    `
+	if err := r.db.SelectContext(ctx, &events, query, now, limit); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return events, nil
+	}
+	ids := make([]int64, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+		events[i].Attempts++
+	}
+	q, args, err := sqlx.In("UPDATE outbox_events SET attempts = attempts + 1, next_attempt_at = ? WHERE id IN (?)", now.Add(lease), ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// 配信済みにする
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []int64, at time.Time) error {
+	return r.update(ctx, "published_at = ?, next_attempt_at = NULL, last_error = NULL", ids, at)
+}
+
+// 配信に失敗したイベントを、nextAtに再送するよう更新する
+func (r *OutboxRepository) RetryLater(ctx context.Context, ids []int64, nextAt time.Time, reason string) error {
+	return r.update(ctx, "next_attempt_at = ?, last_error = ?", ids, nextAt, reason)
+}
+
+// 配信を諦める (last_errorを残し、再送しない)
+func (r *OutboxRepository) MarkFailed(ctx context.Context, ids []int64, reason string) error {
+	return r.update(ctx, "next_attempt_at = NULL, last_error = ?", ids, reason)
+}
+
+func (r *OutboxRepository) update(ctx context.Context, set string, ids []int64, values ...interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("UPDATE outbox_events SET "+set+" WHERE id IN (?)", append(values, ids)...)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+	return err
+}
+
+// beforeより前に配信済みになったイベントを削除し、削除件数を返す
+func (r *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM outbox_events WHERE published_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 配信するリレーがない場合に使うOutbox (記録せずに捨てる)
+type discardOutbox struct{}
+
+func (discardOutbox) Add(ctx context.Context, events []model.OutboxEvent) error { return nil }
+
+func (discardOutbox) ClaimPending(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (discardOutbox) MarkPublished(ctx context.Context, ids []int64, at time.Time) error { return nil }
+
+func (discardOutbox) RetryLater(ctx context.Context, ids []int64, nextAt time.Time, reason string) error {
+	return nil
+}
+
+func (discardOutbox) MarkFailed(ctx context.Context, ids []int64, reason string) error { return nil }
+
+func (discardOutbox) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
@@ -1,28 +1,36 @@
 package repository
 
 import (
+	"backend/internal/metrics"
 	"backend/internal/model"
 	"context"
 	"fmt"
 	"strconv" // ORDER BY のために必要
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
 )
 
+const productTotalCacheKey = "product:count:total"
+
+// メトリクス上のキャッシュ名
+const productTotalCacheName = "product_total"
+
 type ProductRepository struct {
-	db  DBTX
-	rdb *redis.Client
+	db DBTX
+	// 一覧の取得に使う (レプリカがある場合はreplicaDB、ない場合はdbと同じ)
+	read DBTX
+	rdb  *redis.Client
 }
 
 func NewProductRepository(db DBTX, rdb *redis.Client) *ProductRepository {
-	return &ProductRepository{db: db, rdb: rdb}
+	return &ProductRepository{db: db, read: db, rdb: rdb}
 }
 
 // 商品一覧を取得 (DB側でソート、フィルタ、ページネーションを実行)
 func (r *ProductRepository) ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error) {
-	fmt.Printf("list products")
-
 	baseQuery := `
 		SELECT product_id, name, value, weight, image, description
 		FROM products
@@ -32,12 +40,13 @@ func (r *ProductRepository) ListProducts(ctx context.Context, userID int, req mo
 		FROM products
 	`
 
-	whereClause := ""
+	// 論理削除された商品は一覧に含めない
+	whereClause := " WHERE deleted_at IS NULL "
 	args := []interface{}{}
 	countArgs := []interface{}{}
 
 	if req.Search != "" {
-		whereClause = " WHERE MATCH(name, description) AGAINST (? IN BOOLEAN MODE) "
+		whereClause += " AND MATCH(name, description) AGAINST (? IN BOOLEAN MODE) "
 		searchPattern := req.Search
 		args = append(args, searchPattern)
 		countArgs = append(countArgs, searchPattern)
@@ -46,26 +55,29 @@ func (r *ProductRepository) ListProducts(ctx context.Context, userID int, req mo
 	var total int
 	var err error
 
-	const totalCacheKey = "product:count:total"
-
 	// 検索条件がない場合のみキャッシュを試みる
 	if req.Search == "" {
-		val, redisErr := r.rdb.Get(ctx, totalCacheKey).Result()
-		if redisErr == nil {
+		val, redisErr := r.rdb.Get(ctx, productTotalCacheKey).Result()
+		switch {
+		case redisErr == nil:
 			// キャッシュヒット
 			total, err = strconv.Atoi(val)
 			if err != nil {
 				// キャッシュデータが不正な場合、フォールバック (total=0のまま)
 				total = 0
 			}
-			// fmt.Printf("Cache Hit: Total=%d", total)
+			metrics.CacheHit(productTotalCacheName)
+		case redisErr == redis.Nil:
+			// キャッシュミス (total=0のまま)
+			metrics.CacheMiss(productTotalCacheName)
+		default:
+			metrics.CacheError(productTotalCacheName)
 		}
-		// else: キャッシュミス (total=0のまま)
 	}
 
 	// キャッシュから取得できなかった場合 (total=0) のみDBに聞く
 	if total == 0 {
-		err = r.db.GetContext(ctx, &total, r.db.Rebind(countQuery+whereClause), countArgs...)
+		err = r.read.GetContext(ctx, &total, r.read.Rebind(countQuery+whereClause), countArgs...)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -73,24 +85,137 @@ func (r *ProductRepository) ListProducts(ctx context.Context, userID int, req mo
 		// DBから取得し、それがキャッシュ対象（検索なし）ならRedisに保存
 		if req.Search == "" {
 			// Setのエラーは非クリティカルなので無視
-			r.rdb.Set(ctx, totalCacheKey, total, 5*time.Minute)
+			r.rdb.Set(ctx, productTotalCacheKey, total, 5*time.Minute)
 		}
 	}
 
 	var products []model.Product
 
+	// SQLインジェクション防止のため、ソート可能な列をホワイトリストで管理
+	sortFieldMap := map[string]string{
+		"product_id": "product_id",
+		"name":       "name",
+		"value":      "value",
+		"weight":     "weight",
+	}
+	sortColumn, ok := sortFieldMap[req.SortField]
+	if !ok {
+		sortColumn = "product_id"
+	}
+	sortOrder := "ASC"
+	if strings.ToUpper(req.SortOrder) == "DESC" {
+		sortOrder = "DESC"
+	}
+
 	finalQuery := baseQuery + whereClause + " "
-	finalQuery += " ORDER BY " + req.SortField + " " + req.SortOrder + " , product_id ASC"
+	finalQuery += " ORDER BY " + sortColumn + " " + sortOrder + " , product_id ASC"
 
 	if req.PageSize > 0 {
 		finalQuery += " LIMIT ? OFFSET ? "
 		args = append(args, req.PageSize, req.Offset)
 	}
 
-	err = r.db.SelectContext(ctx, &products, r.db.Rebind(finalQuery), args...)
+	err = r.read.SelectContext(ctx, &products, r.read.Rebind(finalQuery), args...)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	return products, total, nil
 }
+
+// 商品IDから商品を取得 (論理削除済みは除く)
+func (r *ProductRepository) FindByID(ctx context.Context, productID int) (*model.Product, error) {
+	var product model.Product
+	query := `
+		SELECT product_id, name, value, weight, image, description
+		FROM products
+		WHERE product_id = ? AND deleted_at IS NULL`
+	if err := r.db.GetContext(ctx, &product, query, productID); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// 指定した商品IDのうち、論理削除されていないものの件数を取得
+func (r *ProductRepository) CountActive(ctx context.Context, productIDs []int) (int, error) {
+	if len(productIDs) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In("SELECT COUNT(*) FROM products WHERE product_id IN (?) AND deleted_at IS NULL", productIDs)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	if err := r.db.GetContext(ctx, &count, r.db.Rebind(query), args...); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// 商品を作成し、生成された商品IDを返す
+func (r *ProductRepository) Create(ctx context.Context, input model.ProductInput) (int, error) {
+	query := `INSERT INTO products (name, value, weight, image, description) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, input.Name, input.Value, input.Weight, input.Image, input.Description)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert product: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	r.invalidateTotal(ctx)
+	return int(id), nil
+}
+
+// 商品を更新する (存在しないか論理削除済みの場合はsql.ErrNoRows)
+func (r *ProductRepository) Update(ctx context.Context, productID int, input model.ProductInput) error {
+	query := `
+		UPDATE products
+		SET name = ?, value = ?, weight = ?, image = ?, description = ?
+		WHERE product_id = ? AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, input.Name, input.Value, input.Weight, input.Image, input.Description, productID)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		// MySQLは値が変わらない場合に0件と返すため、存在するかを確認する
+		if _, findErr := r.FindByID(ctx, productID); findErr != nil {
+			return findErr
+		}
+	}
+	return nil
+}
+
+// 商品画像のパスを更新する
+func (r *ProductRepository) UpdateImage(ctx context.Context, productID int, imagePath string) error {
+	query := `UPDATE products SET image = ? WHERE product_id = ? AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, imagePath, productID)
+	if err != nil {
+		return fmt.Errorf("failed to update product image: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		if _, findErr := r.FindByID(ctx, productID); findErr != nil {
+			return findErr
+		}
+	}
+	return nil
+}
+
+// 商品を論理削除する (既に削除済みの場合はsql.ErrNoRows)
+func (r *ProductRepository) SoftDelete(ctx context.Context, productID int) error {
+	query := `UPDATE products SET deleted_at = NOW() WHERE product_id = ? AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, productID)
+	if err != nil {
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	r.invalidateTotal(ctx)
+	return nil
+}
+
+// 総件数キャッシュを破棄する (エラーは非クリティカルなので無視)
+func (r *ProductRepository) invalidateTotal(ctx context.Context) {
+	r.rdb.Del(ctx, productTotalCacheKey)
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"backend/internal/logging"
+	"backend/internal/metrics"
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// レプリカから読んでよいかを返す (db.ReplicaMonitorが実装する)
+type ReplicaHealth interface {
+	Healthy() bool
+}
+
+// 読み取り専用のクエリをレプリカに振り分けるDBTX
+// レプリカが遅延している場合や、レプリカでエラーになった場合はプライマリで処理する
+// 書き込みは常にプライマリで行う
+type replicaDB struct {
+	primary DBTX
+	replica DBTX
+	health  ReplicaHealth
+}
+
+func (r *replicaDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.read(ctx, func(db DBTX) error {
+		return db.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (r *replicaDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.read(ctx, func(db DBTX) error {
+		// レプリカで途中まで読んだ行が残らないよう、プライマリで読み直す前に空にする
+		v := reflect.ValueOf(dest).Elem()
+		v.Set(reflect.Zero(v.Type()))
+		return db.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+// 行を読み始める前のエラーのみプライマリで読み直す (読み込み中のエラーは呼び出し元に返る)
+func (r *replicaDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	var rows *sqlx.Rows
+	err := r.read(ctx, func(db DBTX) error {
+		var err error
+		rows, err = db.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (r *replicaDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r *replicaDB) Rebind(query string) string {
+	return r.primary.Rebind(query)
+}
+
+func (r *replicaDB) read(ctx context.Context, f func(db DBTX) error) error {
+	if !r.health.Healthy() {
+		metrics.ReplicaRead("primary_lag")
+		return f(r.primary)
+	}
+	err := f(r.replica)
+	if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+		metrics.ReplicaRead("replica")
+		return err
+	}
+	logging.Warn(ctx, "replica read failed, retrying on primary", "error", err)
+	metrics.ReplicaRead("primary_error")
+	return f(r.primary)
+}
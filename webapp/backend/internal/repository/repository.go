@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend/internal/model"
+)
+
+// サービス層が依存するリポジトリのインターフェース
+// MySQL/Redisによる実装(*XxxRepository)と、メモリ上の実装(NewMemoryStore)がある
+// 見つからない場合はいずれの実装もsql.ErrNoRowsを返す
+
+type Users interface {
+	FindByUserName(ctx context.Context, userName string) (*model.User, error)
+	Create(ctx context.Context, user *model.User) (int, error)
+}
+
+type Sessions interface {
+	Create(ctx context.Context, userID int, duration time.Duration) (string, time.Time, error)
+	FindUserBySessionID(ctx context.Context, sessionID string) (*model.SessionUser, error)
+}
+
+type Products interface {
+	ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error)
+	FindByID(ctx context.Context, productID int) (*model.Product, error)
+	CountActive(ctx context.Context, productIDs []int) (int, error)
+	Create(ctx context.Context, input model.ProductInput) (int, error)
+	Update(ctx context.Context, productID int, input model.ProductInput) error
+	UpdateImage(ctx context.Context, productID int, imagePath string) error
+	SoftDelete(ctx context.Context, productID int) error
+}
+
+type Orders interface {
+	Create(ctx context.Context, order *model.Order) (string, error)
+	CreateBulk(ctx context.Context, orders []model.Order) ([]string, error)
+	Import(ctx context.Context, orders []model.Order) error
+	UpdateStatuses(ctx context.Context, orderIDs []int64, newStatus string) error
+	ResetStatuses(ctx context.Context, fromStatus, toStatus string) (int64, error)
+	FindUserIDs(ctx context.Context, orderIDs []int64) (map[int64]int, error)
+	GetShippingOrders(ctx context.Context) ([]model.Order, error)
+	ListOrders(ctx context.Context, userID int, req model.ListRequest) ([]model.Order, int, error)
+	EachOrder(ctx context.Context, userID int, req model.ListRequest, fn func(model.Order) error) error
+}
+
+// 注文のドメインイベント (注文の変更と同じトランザクションで記録する)
+// ClaimPendingはトランザクション内で呼び、コミット後に配信してMarkPublished・RetryLater・MarkFailedのいずれかを呼ぶ
+type Outbox interface {
+	Add(ctx context.Context, events []model.OutboxEvent) error
+	ClaimPending(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []int64, at time.Time) error
+	RetryLater(ctx context.Context, ids []int64, nextAt time.Time, reason string) error
+	MarkFailed(ctx context.Context, ids []int64, reason string) error
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Webhookの登録と配信
+// ClaimDue・DeadLetter・Replayはトランザクション内で呼ぶ
+type Webhooks interface {
+	CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) (int64, error)
+	ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	Enqueue(ctx context.Context, events []model.OutboxEvent, now time.Time) (int, error)
+	ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	DeleteDelivery(ctx context.Context, id int64) error
+	RetryDelivery(ctx context.Context, id int64, nextAt time.Time, reason string) error
+	DeadLetter(ctx context.Context, id int64, reason string, now time.Time) error
+	ListDeadLetters(ctx context.Context, subscriptionID int64, limit int) ([]model.WebhookDeadLetter, error)
+	Replay(ctx context.Context, subscriptionID int64, ids []int64, now time.Time) (int64, error)
+}
+
+// ログイン試行回数はトランザクションの対象外
+type LoginAttempts interface {
+	IncrFailure(ctx context.Context, key string, window time.Duration) (int64, error)
+	Reset(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, duration time.Duration) error
+	LockRemaining(ctx context.Context, key string) (time.Duration, error)
+}
+
+// 注文イベントの配信もトランザクションの対象外 (コミット後に発行する)
+// IDは"<ミリ秒>-<連番>"形式で、CompareEventIDsで発行順に比較できる
+type OrderEvents interface {
+	Publish(ctx context.Context, events []model.OrderEvent) error
+	Subscribe(ctx context.Context, userID int, lastEventID string) (<-chan model.OrderEvent, error)
+}
+
+var (
+	_ Users         = (*UserRepository)(nil)
+	_ Sessions      = (*SessionRepository)(nil)
+	_ Products      = (*ProductRepository)(nil)
+	_ Orders        = (*OrderRepository)(nil)
+	_ Outbox        = (*OutboxRepository)(nil)
+	_ Outbox        = discardOutbox{}
+	_ Webhooks      = (*WebhookRepository)(nil)
+	_ LoginAttempts = (*LoginAttemptRepository)(nil)
+	_ OrderEvents   = (*OrderEventRepository)(nil)
+)
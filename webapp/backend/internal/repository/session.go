@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"backend/internal/model"
 	"context"
 	"time"
 
@@ -32,18 +33,19 @@ func (r *SessionRepository) Create(ctx context.Context, userBusinessID int, dura
 	return sessionIDStr, expiresAt, nil
 }
 
-// セッションIDからユーザーIDを取得
-func (r *SessionRepository) FindUserBySessionID(ctx context.Context, sessionID string) (int, error) {
-	var userID int
+// セッションIDからユーザーIDとロールを取得
+func (r *SessionRepository) FindUserBySessionID(ctx context.Context, sessionID string) (*model.SessionUser, error) {
+	var user model.SessionUser
 	query := `
 		SELECT 
-			u.user_id
+			u.user_id,
+			u.role
 		FROM users u
 		JOIN user_sessions s ON u.user_id = s.user_id
 		WHERE s.session_uuid = ? AND s.expires_at > ?`
-	err := r.db.GetContext(ctx, &userID, query, sessionID, time.Now())
+	err := r.db.GetContext(ctx, &user, query, sessionID, time.Now())
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return userID, nil
+	return &user, nil
 }
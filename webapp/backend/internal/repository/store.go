@@ -2,48 +2,94 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 )
 
 type Store struct {
-	db  DBTX
-	rdb *redis.Client
+	UserRepo    Users
+	SessionRepo Sessions
+	ProductRepo Products
+	OrderRepo   Orders
+	OutboxRepo  Outbox
+	WebhookRepo Webhooks
 
-	UserRepo    *UserRepository
-	SessionRepo *SessionRepository
-	ProductRepo *ProductRepository
-	OrderRepo   *OrderRepository
+	LoginAttemptRepo LoginAttempts
+	OrderEventRepo   OrderEvents
+
+	// トランザクションを開始し、その中で使うStoreをfnに渡す
+	// トランザクション内のStoreではnilになり、ExecTxは外側のトランザクションに参加する
+	beginTx func(ctx context.Context, fn func(txStore *Store) error) error
+}
+
+// MySQLとRedisを使うStore
+func NewStore(db *sqlx.DB, rdb *redis.Client) *Store {
+	return NewReplicatedStore(db, nil, nil, rdb)
 }
 
-func NewStore(db DBTX, rdb *redis.Client) *Store {
+// 商品一覧・注文履歴をレプリカから読むStore (replicaがnilの場合はNewStoreと同じ)
+// 書き込み直後に読み直すことがあるメソッドや、トランザクション内の読み取りはプライマリで処理する
+func NewReplicatedStore(db *sqlx.DB, replica *sqlx.DB, health ReplicaHealth, rdb *redis.Client) *Store {
+	var read DBTX = db
+	if replica != nil {
+		read = &replicaDB{primary: db, replica: replica, health: health}
+	}
+	s := newSQLStore(db, read, rdb, NewLoginAttemptRepository(rdb), NewOrderEventRepository(rdb))
+	s.beginTx = func(ctx context.Context, fn func(txStore *Store) error) error {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		// メモリフォールバックの状態を共有するため、トランザクション外のものを引き継ぐ
+		if err := fn(newSQLStore(tx, tx, rdb, s.LoginAttemptRepo, s.OrderEventRepo)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	return s
+}
+
+func newSQLStore(db DBTX, read DBTX, rdb *redis.Client, attempts LoginAttempts, events OrderEvents) *Store {
+	products := NewProductRepository(db, rdb)
+	products.read = read
+	orders := NewOrderRepository(db)
+	orders.read = read
 	return &Store{
-		db:          db,
-		rdb:         rdb,
 		UserRepo:    NewUserRepository(db),
 		SessionRepo: NewSessionRepository(db),
-		ProductRepo: NewProductRepository(db, rdb),
-		OrderRepo:   NewOrderRepository(db),
+		ProductRepo: products,
+		OrderRepo:   orders,
+		OutboxRepo:  NewOutboxRepository(db),
+		WebhookRepo: NewWebhookRepository(db),
+
+		LoginAttemptRepo: attempts,
+		OrderEventRepo:   events,
 	}
 }
 
+// fnをトランザクション内で実行する。fnがエラーを返した場合はロールバックする
+// トランザクション内のStoreから呼んだ場合は、新しいトランザクションを開始せずそのまま実行する
 func (s *Store) ExecTx(ctx context.Context, fn func(txStore *Store) error) error {
-	db, ok := s.db.(*sqlx.DB)
-	if !ok {
+	if s.beginTx == nil {
 		return fn(s)
 	}
+	return s.beginTx(ctx, fn)
+}
 
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	txStore := NewStore(tx, s.rdb)
-	if err := fn(txStore); err != nil {
-		return err
+// イベントをoutboxに記録しないようにする (配信するリレーを動かさない場合に、outbox_eventsに溜まり続けないようにする)
+// トランザクション内のStoreにも引き継ぐ
+func (s *Store) DiscardOutbox() {
+	s.OutboxRepo = discardOutbox{}
+	if beginTx := s.beginTx; beginTx != nil {
+		s.beginTx = func(ctx context.Context, fn func(txStore *Store) error) error {
+			return beginTx(ctx, func(txStore *Store) error {
+				txStore.OutboxRepo = discardOutbox{}
+				return fn(txStore)
+			})
+		}
 	}
-
-	return tx.Commit()
 }
@@ -20,7 +20,7 @@ func NewUserRepository(db DBTX) *UserRepository {
 // ログイン時に使用
 func (r *UserRepository) FindByUserName(ctx context.Context, userName string) (*model.User, error) {
 	var user model.User
-	query := "SELECT user_id, password_hash, user_name FROM users WHERE user_name = ?"
+	query := "SELECT user_id, password_hash, user_name, role FROM users WHERE user_name = ?"
 
 	err := r.db.GetContext(ctx, &user, query, userName)
 	if err != nil {
@@ -31,3 +31,18 @@ func (r *UserRepository) FindByUserName(ctx context.Context, userName string) (*
 	}
 	return &user, nil
 }
+
+// ユーザーを作成し、生成されたユーザーIDを返す
+// 運用コマンド(create-user, seed)から使用
+func (r *UserRepository) Create(ctx context.Context, user *model.User) (int, error) {
+	query := "INSERT INTO users (password_hash, user_name, role) VALUES (?, ?, ?)"
+	result, err := r.db.ExecContext(ctx, query, user.PasswordHash, user.UserName, user.Role)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
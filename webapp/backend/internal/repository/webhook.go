@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Webhookの登録と、登録ごとの配信
+type WebhookRepository struct {
+	db DBTX
+}
+
+func NewWebhookRepository(db DBTX) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+type webhookSubscriptionRow struct {
+	ID         int64     `db:"id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	EventTypes string    `db:"event_types"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (row webhookSubscriptionRow) toModel() model.WebhookSubscription {
+	return model.WebhookSubscription{
+		ID:         row.ID,
+		URL:        row.URL,
+		Secret:     row.Secret,
+		EventTypes: strings.Split(row.EventTypes, ","),
+		CreatedAt:  row.CreatedAt,
+	}
+}
+
+// 登録を作成し、IDを返す
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO webhook_subscriptions (url, secret, event_types, created_at) VALUES (?, ?, ?, ?)",
+		sub.URL, sub.Secret, strings.Join(sub.EventTypes, ","), sub.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// 登録をID順に取得する (Secretを含む)
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	var rows []webhookSubscriptionRow
+	if err := r.db.SelectContext(ctx, &rows, "SELECT id, url, secret, event_types, created_at FROM webhook_subscriptions ORDER BY id"); err != nil {
+		return nil, err
+	}
+	subs := make([]model.WebhookSubscription, len(rows))
+	for i, row := range rows {
+		subs[i] = row.toModel()
+	}
+	return subs, nil
+}
+
+// 登録を削除する (未配信の配信と再送待ちの配信も削除される)
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// イベントの種類が一致する登録ごとに配信を予約し、予約した件数を返す
+// 同じ登録・同じイベントの配信は一度だけ予約する
+func (r *WebhookRepository) Enqueue(ctx context.Context, events []model.OutboxEvent, now time.Time) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+	subs, err := r.ListSubscriptions(ctx)
+	if err != nil || len(subs) == 0 {
+		return 0, err
+	}
+
+	var placeholders []string
+	var args []interface{}
+	for _, e := range events {
+		var body []byte
+		for _, sub := range subs {
+			if !slices.Contains(sub.EventTypes, e.EventType) {
+				continue
+			}
+			if body == nil {
+				if body, err = json.Marshal(e); err != nil {
+					return 0, err
+				}
+			}
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+			// []byteはバイナリ文字列として送られ、JSON型の列に入れられないため文字列にする
+			args = append(args, sub.ID, e.EventID, e.EventType, string(body), now, now)
+		}
+	}
+	if len(placeholders) == 0 {
+		return 0, nil
+	}
+	query := `INSERT IGNORE INTO webhook_deliveries (subscription_id, event_id, event_type, body, next_attempt_at, created_at) VALUES ` +
+		strings.Join(placeholders, ", ")
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+	return len(placeholders), nil
+}
+
+// 送信時刻になった配信を取得し、lease後まで他のワーカーが取得しないようにする
+// トランザクション内で呼び、コミット後に送信する
+func (r *WebhookRepository) ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	query := `
+        SELECT d.id, d.subscription_id, s.url, s.secret, d.event_id, d.event_type, d.body, d.attempts, d.created_at
+        FROM webhook_deliveries d
+        JOIN webhook_subscriptions s ON s.id = d.subscription_id
+        WHERE d.next_attempt_at <= ?
+        ORDER BY d.next_attempt_at
+        LIMIT ?
+        FOR UPDATE OF d SKIP LOCKED
+    `
+	if err := r.db.SelectContext(ctx, &deliveries, query, now, limit); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	ids := make([]int64, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+	}
+	q, args, err := sqlx.In("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN (?)", now.Add(lease), ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// 送信に成功した配信を削除する
+func (r *WebhookRepository) DeleteDelivery(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE id = ?", id)
+	return err
+}
+
+// 送信に失敗した配信を、nextAtに再送するよう更新する
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, id int64, nextAt time.Time, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?, last_error = ? WHERE id = ?",
+		nextAt, reason, id)
+	return err
+}
+
+// 再試行の上限に達した配信を再送待ちに移す (トランザクション内で呼ぶ)
+func (r *WebhookRepository) DeadLetter(ctx context.Context, id int64, reason string, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO webhook_dead_letters (subscription_id, event_id, event_type, body, attempts, last_error, created_at, failed_at)
+        SELECT subscription_id, event_id, event_type, body, attempts + 1, ?, created_at, ?
+        FROM webhook_deliveries WHERE id = ?
+    `, reason, now, id)
+	if err != nil {
+		return err
+	}
+	return r.DeleteDelivery(ctx, id)
+}
+
+// 登録の再送待ちの配信を新しい順に取得する
+func (r *WebhookRepository) ListDeadLetters(ctx context.Context, subscriptionID int64, limit int) ([]model.WebhookDeadLetter, error) {
+	var deadLetters []model.WebhookDeadLetter
+	query := `
+        SELECT id, subscription_id, event_id, event_type, body, attempts, COALESCE(last_error, '') AS last_error, created_at, failed_at
+        FROM webhook_dead_letters
+        WHERE subscription_id = ?
+        ORDER BY id DESC
+        LIMIT ?
+    `
+	if err := r.db.SelectContext(ctx, &deadLetters, query, subscriptionID, limit); err != nil {
+		return nil, err
+	}
+	return deadLetters, nil
+}
+
+// 再送待ちの配信を未配信に戻し、戻した件数を返す (idsが空の場合は登録のすべて)
+// トランザクション内で呼ぶ
+func (r *WebhookRepository) Replay(ctx context.Context, subscriptionID int64, ids []int64, now time.Time) (int64, error) {
+	where := "subscription_id = ?"
+	args := []interface{}{subscriptionID}
+	if len(ids) > 0 {
+		where += " AND id IN (?)"
+		args = append(args, ids)
+	}
+
+	// 再送待ちと同じイベントが未配信に残っている場合は、そちらを送信時刻にする
+	insert, insertArgs, err := sqlx.In(`
+        INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, body, next_attempt_at, created_at)
+        SELECT subscription_id, event_id, event_type, body, ?, created_at
+        FROM webhook_dead_letters WHERE `+where+`
+        ON DUPLICATE KEY UPDATE next_attempt_at = ?
+    `, append(append([]interface{}{now}, args...), now)...)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(insert), insertArgs...); err != nil {
+		return 0, fmt.Errorf("failed to replay webhook deliveries: %w", err)
+	}
+
+	del, delArgs, err := sqlx.In("DELETE FROM webhook_dead_letters WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.db.ExecContext(ctx, r.db.Rebind(del), delArgs...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"backend/internal/handler"
+	"backend/internal/imagestore"
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/openapi"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testRobotAPIKey = "test-robot-key"
+	testCSRFToken   = "test-csrf-token"
+	testPassword    = "password"
+)
+
+// 本番と同じルート・ミドルウェアに、リクエストとレスポンスの両方をstrictで検証するValidatorを組み合わせる
+// ストアはメモリ上の実装を使う
+type routeTest struct {
+	t      *testing.T
+	router *chi.Mux
+	store  *repository.Store
+	// ロール("customer" / "admin")ごとのセッションID
+	sessions map[string]string
+}
+
+func newRouteTest(t *testing.T) *routeTest {
+	t.Helper()
+	ctx := context.Background()
+	db := repository.NewMemoryDB()
+	store := repository.NewMemoryStore(db)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := make(map[string]string)
+	for _, role := range []string{model.RoleCustomer, model.RoleAdmin} {
+		user := db.AddUser(model.User{UserName: role, PasswordHash: string(hash), Role: role})
+		sessions[role], _, err = store.SessionRepo.Create(ctx, user.UserID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec, err := openapi.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := openapi.NewValidator(spec, true, openapi.ResponseStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	productService := service.NewProductService(store)
+	imageService := service.NewImageService(store, imagestore.NewFileStore(t.TempDir()))
+	proxies, err := handler.ParseTrustedProxies(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Router: chi.NewRouter()}
+	s.setupRoutes(
+		handler.NewAuthHandler(service.NewAuthService(store), handler.DefaultCookieConfig(), proxies),
+		handler.NewProductHandler(productService, imageService),
+		handler.NewOrderHandler(service.NewOrderService(store)),
+		handler.NewRobotHandler(service.NewRobotService(store)),
+		handler.NewAdminProductHandler(productService, imageService),
+		handler.NewAdminWebhookHandler(service.NewWebhookService(store, false)),
+		middleware.UserAuthMiddleware(store.SessionRepo),
+		middleware.RobotAuthMiddleware(testRobotAPIKey),
+		middleware.CSRFMiddleware(),
+		middleware.MaxBodySize(1<<20),
+		validator.Middleware,
+	)
+	return &routeTest{t: t, router: s.Router, store: store, sessions: sessions}
+}
+
+// リクエストを送り、ステータスを確認してレスポンスを返す
+// role が "robot" の場合はAPIキー、それ以外はセッションとCSRFトークンを付ける
+func (rt *routeTest) do(role, method, target string, body io.Reader, contentType string, wantStatus int) *httptest.ResponseRecorder {
+	rt.t.Helper()
+	return rt.doContext(context.Background(), role, method, target, body, contentType, wantStatus)
+}
+
+func (rt *routeTest) doContext(ctx context.Context, role, method, target string, body io.Reader, contentType string, wantStatus int) *httptest.ResponseRecorder {
+	rt.t.Helper()
+	req := httptest.NewRequestWithContext(ctx, method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch role {
+	case "":
+	case "robot":
+		req.Header.Set("X-API-KEY", testRobotAPIKey)
+	default:
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: rt.sessions[role]})
+		req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: testCSRFToken})
+		req.Header.Set(middleware.CSRFHeaderName, testCSRFToken)
+	}
+	rec := httptest.NewRecorder()
+	rt.router.ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		rt.t.Fatalf("%s %s: status = %d, want %d\n%s", method, target, rec.Code, wantStatus, rec.Body.String())
+	}
+	return rec
+}
+
+func (rt *routeTest) doJSON(role, method, target string, body interface{}, wantStatus int) *httptest.ResponseRecorder {
+	rt.t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			rt.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	return rt.do(role, method, target, r, "application/json", wantStatus)
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode response: %v\n%s", err, rec.Body.String())
+	}
+	return v
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// すべてのルートを実際のハンドラーで呼び、リクエストとレスポンスが定義に合うことを確認する
+// ルートを追加した場合はここにも追加しないと失敗する
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	rt := newRouteTest(t)
+	covered := make(map[string]bool)
+	route := func(method, pattern string) { covered[method+" "+pattern] = true }
+
+	// --- 認証 ---
+	route("POST", "/api/login")
+	rt.doJSON("", "POST", "/api/login", model.LoginRequest{UserName: model.RoleCustomer, Password: testPassword}, http.StatusOK)
+	rt.doJSON("", "POST", "/api/login", model.LoginRequest{UserName: model.RoleCustomer, Password: "wrong"}, http.StatusUnauthorized)
+	rt.doJSON("", "POST", "/api/login", map[string]string{"user_name": "x"}, http.StatusBadRequest)
+
+	// --- 管理者: 商品 ---
+	route("POST", "/api/admin/products")
+	created := decode[model.Product](t, rt.doJSON(model.RoleAdmin, "POST", "/api/admin/products",
+		model.ProductInput{Name: "テスト商品", Value: 100, Weight: 3, Description: "説明"}, http.StatusCreated))
+	productPath := fmt.Sprintf("/api/admin/products/%d", created.ProductID)
+	rt.doJSON(model.RoleCustomer, "POST", "/api/admin/products", model.ProductInput{Name: "x", Value: 1, Weight: 1}, http.StatusForbidden)
+
+	route("GET", "/api/admin/products/{productID}")
+	rt.do(model.RoleAdmin, "GET", productPath, nil, "", http.StatusOK)
+	rt.do(model.RoleAdmin, "GET", "/api/admin/products/999999", nil, "", http.StatusNotFound)
+
+	route("PUT", "/api/admin/products/{productID}")
+	rt.doJSON(model.RoleAdmin, "PUT", productPath, model.ProductInput{Name: "テスト商品2", Value: 120, Weight: 3}, http.StatusOK)
+
+	route("POST", "/api/admin/products/{productID}/image")
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, err := mw.CreateFormFile("image", "test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(testPNG(t))
+	mw.Close()
+	uploaded := decode[model.ProductImage](t, rt.do(model.RoleAdmin, "POST", productPath+"/image", &form, mw.FormDataContentType(), http.StatusCreated))
+
+	// --- 商品・画像 ---
+	route("POST", "/api/v1/product")
+	rt.doJSON(model.RoleCustomer, "POST", "/api/v1/product", model.ListRequest{Page: 1, PageSize: 10, SortField: "value", SortOrder: "desc"}, http.StatusOK)
+
+	route("GET", "/api/v1/image")
+	rt.do(model.RoleCustomer, "GET", "/api/v1/image?path="+uploaded.Path, nil, "", http.StatusOK)
+	rt.do(model.RoleCustomer, "GET", "/api/v1/image?path="+uploaded.Path+"&w=150", nil, "", http.StatusOK)
+	rt.do(model.RoleCustomer, "GET", "/api/v1/image?path=products/missing.png", nil, "", http.StatusNotFound)
+
+	// --- 注文 ---
+	route("POST", "/api/v1/product/post")
+	rt.doJSON(model.RoleCustomer, "POST", "/api/v1/product/post",
+		model.CreateOrderRequest{Items: []model.RequestItem{{ProductID: created.ProductID, Quantity: 2}}}, http.StatusCreated)
+	rt.doJSON(model.RoleCustomer, "POST", "/api/v1/product/post", map[string]interface{}{"items": "x"}, http.StatusBadRequest)
+
+	route("POST", "/api/v1/orders")
+	orders := decode[struct {
+		Data  []model.Order `json:"data"`
+		Total int           `json:"total"`
+	}](t, rt.doJSON(model.RoleCustomer, "POST", "/api/v1/orders", model.ListRequest{Page: 1, PageSize: 10}, http.StatusOK))
+	if orders.Total != 2 {
+		t.Fatalf("orders total = %d, want 2", orders.Total)
+	}
+
+	// CSRFトークンのヘッダーがない場合は拒否する
+	req := httptest.NewRequest("POST", "/api/v1/product/post", strings.NewReader(`{"items":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: rt.sessions[model.RoleCustomer]})
+	req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: testCSRFToken})
+	rec := httptest.NewRecorder()
+	rt.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("POST /api/v1/product/post without CSRF header: status = %d, want 403", rec.Code)
+	}
+
+	route("GET", "/api/v1/orders/export")
+	rt.do(model.RoleCustomer, "GET", "/api/v1/orders/export?format=csv&sort_field=created_at&sort_order=asc", nil, "", http.StatusOK)
+	rt.do(model.RoleCustomer, "GET", "/api/v1/orders/export?format=ndjson", nil, "", http.StatusOK)
+	rt.do(model.RoleCustomer, "GET", "/api/v1/orders/export?format=xml", nil, "", http.StatusBadRequest)
+
+	route("GET", "/api/v1/orders/stream")
+	streamCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rt.doContext(streamCtx, model.RoleCustomer, "GET", "/api/v1/orders/stream", nil, "", http.StatusOK)
+
+	// --- ロボット ---
+	route("GET", "/api/robot/delivery-plan")
+	plan := decode[model.DeliveryPlan](t, rt.do("robot", "GET", "/api/robot/delivery-plan?capacity=100", nil, "", http.StatusOK))
+	if len(plan.Orders) != 2 {
+		t.Fatalf("delivery plan has %d orders, want 2", len(plan.Orders))
+	}
+	rt.do("robot", "GET", "/api/robot/delivery-plan?capacity=0", nil, "", http.StatusBadRequest)
+
+	route("PATCH", "/api/robot/orders/status")
+	rt.doJSON("robot", "PATCH", "/api/robot/orders/status",
+		model.UpdateOrderStatusRequest{OrderID: plan.Orders[0].OrderID, NewStatus: "completed"}, http.StatusOK)
+
+	// --- 管理者: Webhook ---
+	route("POST", "/api/admin/webhooks")
+	sub := decode[model.WebhookSubscription](t, rt.doJSON(model.RoleAdmin, "POST", "/api/admin/webhooks",
+		model.WebhookSubscriptionInput{URL: "https://example.com/hook", EventTypes: []string{model.EventOrderCreated}}, http.StatusCreated))
+	if !strings.HasPrefix(sub.Secret, "whsec_") {
+		t.Fatalf("secret = %q, want whsec_ prefix", sub.Secret)
+	}
+	webhookPath := fmt.Sprintf("/api/admin/webhooks/%d", sub.ID)
+	rt.doJSON(model.RoleAdmin, "POST", "/api/admin/webhooks",
+		model.WebhookSubscriptionInput{URL: "ftp://example.com", EventTypes: []string{model.EventOrderCreated}}, http.StatusBadRequest)
+
+	route("GET", "/api/admin/webhooks")
+	rt.do(model.RoleAdmin, "GET", "/api/admin/webhooks", nil, "", http.StatusOK)
+
+	route("GET", "/api/admin/webhooks/{webhookID}/dead-letters")
+	rt.do(model.RoleAdmin, "GET", webhookPath+"/dead-letters", nil, "", http.StatusOK)
+
+	route("POST", "/api/admin/webhooks/{webhookID}/replay")
+	rt.do(model.RoleAdmin, "POST", webhookPath+"/replay", nil, "", http.StatusOK)
+	rt.doJSON(model.RoleAdmin, "POST", webhookPath+"/replay", map[string][]int64{"dead_letter_ids": {1}}, http.StatusOK)
+
+	route("DELETE", "/api/admin/webhooks/{webhookID}")
+	rt.do(model.RoleAdmin, "DELETE", webhookPath, nil, "", http.StatusNoContent)
+	rt.do(model.RoleAdmin, "DELETE", webhookPath, nil, "", http.StatusNotFound)
+
+	route("DELETE", "/api/admin/products/{productID}")
+	rt.do(model.RoleAdmin, "DELETE", productPath, nil, "", http.StatusNoContent)
+	rt.do(model.RoleAdmin, "GET", productPath, nil, "", http.StatusNotFound)
+
+	// 登録されたルートがすべて呼ばれたか
+	var missing []string
+	err = chi.Walk(rt.router, func(method, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if key := method + " " + pattern; !covered[key] {
+			missing = append(missing, key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(missing)
+	if len(missing) > 0 {
+		t.Errorf("routes not covered by this test: %v", missing)
+	}
+}
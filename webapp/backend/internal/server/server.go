@@ -1,16 +1,29 @@
 package server
 
 import (
+	"backend/internal/apierror"
+	"backend/internal/config"
 	"backend/internal/db"
 	"backend/internal/handler"
+	"backend/internal/health"
+	"backend/internal/imagestore"
+	"backend/internal/metrics"
 	"backend/internal/middleware"
+	"backend/internal/migrate"
+	"backend/internal/model"
+	"backend/internal/openapi"
+	"backend/internal/outbox"
 	"backend/internal/repository"
 	"backend/internal/service"
+	"backend/internal/webhook"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
@@ -21,72 +34,214 @@ import (
 
 type Server struct {
 	Router *chi.Mux
+	port   string
+
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	// シャットダウン開始後はfalseになり、ヘルスチェックが失敗する
+	ready atomic.Bool
+	// シャットダウン時に呼ぶ停止処理 (登録と逆順に呼ぶ)
+	closers []closer
+	// シャットダウン開始時に、終わりのないリクエスト(SSE)を終えるために呼ぶ処理
+	onDrain []func()
 }
 
-func NewServer() (*Server, *sqlx.DB, *redis.Client, error) {
+// readinessチェックで依存サービスの応答を待つ上限
+const healthCheckTimeout = 2 * time.Second
+
+type closer struct {
+	name string
+	fn   func(context.Context) error
+}
+
+func NewServer(cfg *config.Config) (*Server, error) {
 	ctx := context.Background()
 
+	cookieCfg, err := cookieConfig(cfg.Auth.Cookie)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := handler.ParseTrustedProxies(cfg.Auth.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		port:            cfg.Server.Port,
+		drainDelay:      cfg.Server.ShutdownDrainDelay.Std(),
+		shutdownTimeout: cfg.Server.ShutdownTimeout.Std(),
+	}
+
 	// 1. Redis接続の初期化と正常性チェック
 	rdbClient := redis.NewClient(&redis.Options{
-		Addr:     "redis:6379", // docker-compose.ymlで定義したサービス名
-		Password: "",           // パスワードがない場合
-		DB:       0,            // 使用するデータベース番号
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
 
 	// Pingによる正常性チェック
 	if _, err := rdbClient.Ping(ctx).Result(); err != nil {
 		rdbClient.Close() // 接続失敗時はクローズ
-		return nil, nil, nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
-	log.Println("Successfully connected to Redis.")
+	slog.Info("connected to redis", "addr", cfg.Redis.Addr)
+	s.OnShutdown("redis", func(context.Context) error { return rdbClient.Close() })
 
-	dbConn, err := db.InitDBConnection()
+	dbConn, err := db.InitDBConnection(cfg.Database)
 	if err != nil {
-		return nil, nil, nil, err
+		s.closeAll(ctx)
+		return nil, err
+	}
+	// 後に登録したものから閉じるため、MySQLはRedisより先に閉じられる
+	// (どちらも使うコンポーネントは両方の後に登録し、接続より先に止める)
+	s.OnShutdown("mysql", func(context.Context) error { return dbConn.Close() })
+	if err := metrics.RegisterDBStats(dbConn.DB, "mysql"); err != nil {
+		s.closeAll(ctx)
+		return nil, fmt.Errorf("failed to register db metrics: %w", err)
+	}
+
+	if err := checkSchema(ctx, dbConn, cfg.Database.RequireMigrations); err != nil {
+		s.closeAll(ctx)
+		return nil, err
 	}
 
-	store := repository.NewStore(dbConn, rdbClient)
+	var replicaConn *sqlx.DB
+	var replicaHealth repository.ReplicaHealth
+	if cfg.Database.ReplicaURL != "" {
+		replicaConn, err = db.InitReplicaConnection(cfg.Database)
+		if err != nil {
+			s.closeAll(ctx)
+			return nil, err
+		}
+		s.OnShutdown("mysql-replica", func(context.Context) error { return replicaConn.Close() })
+		if err := metrics.RegisterDBStats(replicaConn.DB, "mysql_replica"); err != nil {
+			s.closeAll(ctx)
+			return nil, fmt.Errorf("failed to register replica db metrics: %w", err)
+		}
+
+		// 接続より先に止まるよう、接続の後に登録する
+		monitor := db.NewReplicaMonitor(replicaConn, cfg.Database.ReplicaMaxLag.Std(), cfg.Database.ReplicaCheckInterval.Std())
+		monitor.Start(ctx)
+		s.OnShutdown("replica-monitor", monitor.Stop)
+		replicaHealth = monitor
+	}
+
+	store := repository.NewReplicatedStore(dbConn, replicaConn, replicaHealth, rdbClient)
+
+	// 接続より先に止まるよう、接続の後に登録する
+	if sink := newOutboxSink(cfg.Outbox, rdbClient); sink != nil || cfg.Webhooks.Enabled {
+		relay := outbox.NewRelay(store, sink, outbox.Config{
+			PollInterval: cfg.Outbox.PollInterval.Std(),
+			BatchSize:    cfg.Outbox.BatchSize,
+			Retention:    cfg.Outbox.Retention.Std(),
+			MaxAttempts:  cfg.Outbox.MaxAttempts,
+			BackoffMax:   cfg.Outbox.BackoffMax.Std(),
+			Webhooks:     cfg.Webhooks.Enabled,
+		})
+		relay.Start()
+		s.OnShutdown("outbox-relay", relay.Stop)
+		slog.Info("outbox relay started", "sink", cfg.Outbox.Sink, "webhooks", cfg.Webhooks.Enabled)
+	} else {
+		// 配信しないイベントが溜まり続けないよう、記録しない
+		store.DiscardOutbox()
+		slog.Info("outbox relay is disabled (outbox.sink is none and webhooks are disabled), order events are not recorded")
+	}
+	if cfg.Webhooks.Enabled {
+		dispatcher := webhook.NewDispatcher(store, webhook.Config{
+			PollInterval:        cfg.Webhooks.PollInterval.Std(),
+			BatchSize:           cfg.Webhooks.BatchSize,
+			MaxAttempts:         cfg.Webhooks.MaxAttempts,
+			BackoffBase:         cfg.Webhooks.BackoffBase.Std(),
+			BackoffMax:          cfg.Webhooks.BackoffMax.Std(),
+			Timeout:             cfg.Webhooks.Timeout.Std(),
+			AllowPrivateTargets: cfg.Webhooks.AllowPrivateTargets,
+		})
+		dispatcher.Start()
+		s.OnShutdown("webhook-dispatcher", dispatcher.Stop)
+	}
 
 	authService := service.NewAuthService(store)
 	orderService := service.NewOrderService(store)
 	productService := service.NewProductService(store)
 	robotService := service.NewRobotService(store)
+	webhookService := service.NewWebhookService(store, cfg.Webhooks.AllowPrivateTargets)
+
+	imageStore, err := newImageStore(ctx, cfg.Image)
+	if err != nil {
+		s.closeAll(ctx)
+		return nil, err
+	}
+	imageService := service.NewImageService(store, imageStore)
 
-	authHandler := handler.NewAuthHandler(authService)
-	productHandler := handler.NewProductHandler(productService)
+	authHandler := handler.NewAuthHandler(authService, cookieCfg, proxies)
+	productHandler := handler.NewProductHandler(productService, imageService)
 	orderHandler := handler.NewOrderHandler(orderService)
+	s.onDrain = append(s.onDrain, orderHandler.CloseStreams)
 	robotHandler := handler.NewRobotHandler(robotService)
+	adminProductHandler := handler.NewAdminProductHandler(productService, imageService)
+	adminWebhookHandler := handler.NewAdminWebhookHandler(webhookService)
+
+	spec, err := openapi.Load(ctx)
+	if err != nil {
+		s.closeAll(ctx)
+		return nil, err
+	}
+	validator, err := openapi.NewValidator(spec, cfg.OpenAPI.ValidateRequests, cfg.OpenAPI.ValidateResponses)
+	if err != nil {
+		s.closeAll(ctx)
+		return nil, err
+	}
+	if !cfg.OpenAPI.ValidateRequests {
+		slog.Warn("request validation is disabled by OPENAPI_VALIDATE_REQUESTS=false")
+	}
+	bodyLimitMW := middleware.MaxBodySize(int64(cfg.Server.MaxBodyBytes))
 
 	userAuthMW := middleware.UserAuthMiddleware(store.SessionRepo)
 
-	robotAPIKey := os.Getenv("ROBOT_API_KEY")
-	if robotAPIKey == "" {
-		log.Println("Warning: ROBOT_API_KEY is not set. Using default key 'test-robot-key'")
-		robotAPIKey = "test-robot-key"
+	if cfg.Auth.RobotAPIKey == config.DefaultRobotAPIKey {
+		slog.Warn("ROBOT_API_KEY is not set, using the default key")
+	}
+	robotAuthMW := middleware.RobotAuthMiddleware(cfg.Auth.RobotAPIKey)
+
+	csrfMW := middleware.CSRFMiddleware()
+	if !cfg.Auth.CSRFEnabled {
+		slog.Warn("CSRF protection is disabled by CSRF_ENABLED=false")
+		csrfMW = func(next http.Handler) http.Handler { return next }
 	}
-	robotAuthMW := middleware.RobotAuthMiddleware(robotAPIKey)
 
 	r := chi.NewRouter()
+	r.NotFound(apierror.NotFound)
+	r.MethodNotAllowed(apierror.MethodNotAllowed)
+	r.Use(metrics.Middleware)
 	r.Use(otelchi.Middleware(
 		"backend-api",
 		otelchi.WithChiRoutes(r),
 		otelchi.WithFilter(func(req *http.Request) bool {
-			return req.URL.Path != "/api/health"
+			return !isHealthCheckPath(req.URL.Path)
 		}),
 	))
+	// otelchiの後に置き、ログにトレースIDが付くようにする
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.Timeout(r, timeoutsFromConfig(cfg.Server)))
 
 	r.Get("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	checker := health.NewChecker(dbConn, rdbClient, healthCheckTimeout, s.ready.Load)
+	r.Get("/healthz", health.Liveness)
+	r.Get("/readyz", checker.Readiness)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
 
-	s := &Server{
-		Router: r,
-	}
+	s.Router = r
 
-	s.setupRoutes(authHandler, productHandler, orderHandler, robotHandler, userAuthMW, robotAuthMW)
+	s.setupRoutes(authHandler, productHandler, orderHandler, robotHandler, adminProductHandler, adminWebhookHandler, userAuthMW, robotAuthMW, csrfMW, bodyLimitMW, validator.Middleware)
 
-	return s, dbConn, rdbClient, nil
+	return s, nil
 }
 
 func (s *Server) setupRoutes(
@@ -94,34 +249,216 @@ func (s *Server) setupRoutes(
 	productHandler *handler.ProductHandler,
 	orderHandler *handler.OrderHandler,
 	robotHandler *handler.RobotHandler,
+	adminProductHandler *handler.AdminProductHandler,
+	adminWebhookHandler *handler.AdminWebhookHandler,
 	userAuthMW func(http.Handler) http.Handler,
 	robotAuthMW func(http.Handler) http.Handler,
+	csrfMW func(http.Handler) http.Handler,
+	bodyLimitMW func(http.Handler) http.Handler,
+	validateMW func(http.Handler) http.Handler,
 ) {
-	s.Router.Post("/api/login", authHandler.Login)
+	// OpenAPI定義による検証は、認証・CSRFのチェックとボディサイズの制限の後に行う
+	s.Router.With(bodyLimitMW, validateMW).Post("/api/login", authHandler.Login)
 
 	s.Router.Route("/api/v1", func(r chi.Router) {
 		r.Use(userAuthMW)
+		// GETなど安全なメソッドは検証しない
+		r.Use(csrfMW)
+		r.Use(bodyLimitMW)
+		r.Use(validateMW)
 		r.Post("/product", productHandler.List)
 		r.Post("/product/post", productHandler.CreateOrders)
 		r.Post("/orders", orderHandler.List)
+		r.Get("/orders/stream", orderHandler.Stream)
+		r.Get("/orders/export", orderHandler.Export)
 		r.Get("/image", productHandler.GetImage)
 	})
 
+	// 管理者向けAPI (商品・在庫・ロボットの管理など)
+	s.Router.Route("/api/admin", func(r chi.Router) {
+		r.Use(userAuthMW)
+		r.Use(csrfMW)
+		r.Use(middleware.RequireRole(model.RoleAdmin))
+		r.Group(func(r chi.Router) {
+			r.Use(bodyLimitMW)
+			r.Use(validateMW)
+			r.Post("/products", adminProductHandler.Create)
+			r.Get("/products/{productID}", adminProductHandler.Get)
+			r.Put("/products/{productID}", adminProductHandler.Update)
+			r.Delete("/products/{productID}", adminProductHandler.Delete)
+			r.Post("/webhooks", adminWebhookHandler.Create)
+			r.Get("/webhooks", adminWebhookHandler.List)
+			r.Delete("/webhooks/{webhookID}", adminWebhookHandler.Delete)
+			r.Get("/webhooks/{webhookID}/dead-letters", adminWebhookHandler.ListDeadLetters)
+			r.Post("/webhooks/{webhookID}/replay", adminWebhookHandler.Replay)
+		})
+		// 画像のアップロードはハンドラーで大きめの上限を適用する
+		r.With(validateMW).Post("/products/{productID}/image", adminProductHandler.UploadImage)
+	})
+
 	s.Router.Route("/api/robot", func(r chi.Router) {
 		r.Use(robotAuthMW)
+		r.Use(bodyLimitMW)
+		r.Use(validateMW)
 		r.Get("/delivery-plan", robotHandler.GetDeliveryPlan)
 		r.Patch("/orders/status", robotHandler.UpdateOrderStatus)
 	})
 }
 
-func (s *Server) Run() {
-	appPort := os.Getenv("PORT")
-	if appPort == "" {
-		appPort = "8080"
+// 設定のタイムアウトをルートと処理の段階に分ける
+func timeoutsFromConfig(c config.ServerConfig) middleware.Timeouts {
+	t := middleware.Timeouts{
+		Default: c.RequestTimeout.Std(),
+		Routes:  make(map[string]time.Duration),
+		Stages:  make(map[string]time.Duration),
 	}
+	for key, d := range c.Timeouts {
+		if method, pattern, ok := config.SplitRouteKey(key); ok {
+			t.Routes[method+" "+pattern] = d.Std()
+		} else {
+			t.Stages[key] = d.Std()
+		}
+	}
+	return t
+}
+
+// ヘルスチェックとメトリクス取得のパスはトレースしない
+func isHealthCheckPath(p string) bool {
+	return p == "/api/health" || p == "/healthz" || p == "/readyz" || p == "/metrics"
+}
+
+// スキーマが最新か確認する
+// 採点時はランナーを使わずにマイグレーションが適用されるため、requireがfalseの場合は警告のみとする
+func checkSchema(ctx context.Context, dbConn *sqlx.DB, require bool) error {
+	m, err := migrate.New(dbConn)
+	if err != nil {
+		return err
+	}
+	err = m.Verify(ctx)
+	if err == nil {
+		return nil
+	}
+	if require {
+		return fmt.Errorf("refusing to start: %w (run 'server migrate up')", err)
+	}
+	slog.Warn("database schema may be out of date", "error", err)
+	return nil
+}
+
+// 設定からCookie属性を組み立てる
+func cookieConfig(c config.CookieConfig) (handler.CookieConfig, error) {
+	cfg := handler.DefaultCookieConfig()
+	secure, err := handler.ParseSecureMode(c.Secure)
+	if err != nil {
+		return cfg, err
+	}
+	sameSite, err := handler.ParseSameSite(c.SameSite)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Secure = secure
+	cfg.SameSite = sameSite
+	cfg.Domain = c.Domain
+	return cfg, nil
+}
+
+// 画像の保存先を設定から決める
+// image.store=s3 の場合はS3互換ストレージ、それ以外はローカルのimage.dir
+func newImageStore(ctx context.Context, c config.ImageConfig) (imagestore.ImageStore, error) {
+	if strings.EqualFold(c.Store, "s3") {
+		store, err := imagestore.NewS3Store(ctx, imagestore.S3Config{
+			Endpoint:  c.S3.Endpoint,
+			Bucket:    c.S3.Bucket,
+			AccessKey: c.S3.AccessKey,
+			SecretKey: c.S3.SecretKey,
+			Region:    c.S3.Region,
+			UseSSL:    c.S3.UseSSL,
+			Prefix:    c.S3.Prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("using S3 image store", "bucket", c.S3.Bucket)
+		return store, nil
+	}
+	return imagestore.NewFileStore(c.Dir), nil
+}
+
+// 注文のドメインイベントの配信先を設定から決める (noneの場合はnil)
+func newOutboxSink(c config.OutboxConfig, rdb *redis.Client) outbox.Sink {
+	switch strings.ToLower(c.Sink) {
+	case "redis":
+		return outbox.NewRedisStreamSink(rdb, c.RedisStream, int64(c.RedisMaxLen))
+	case "webhook":
+		return outbox.NewWebhookSink(c.WebhookURL, c.WebhookTimeout.Std())
+	case "none":
+		return nil
+	}
+	return outbox.LogSink{}
+}
+
+// シャットダウン時に呼ぶ停止処理を登録する
+// バックグラウンドワーカーなど、後から登録したものほど先に停止する
+func (s *Server) OnShutdown(name string, fn func(context.Context) error) {
+	s.closers = append(s.closers, closer{name: name, fn: fn})
+}
+
+// ctxがキャンセルされる(シグナルを受け取る)までリクエストを処理し、その後グレースフルに停止する
+func (s *Server) Run(ctx context.Context) error {
+	httpServer := &http.Server{
+		Addr:              ":" + s.port,
+		Handler:           s.Router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	for _, f := range s.onDrain {
+		httpServer.RegisterOnShutdown(f)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "port", s.port)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err := <-serveErr:
+		s.ready.Store(false)
+		s.closeAll(context.Background())
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
+	}
+
+	// 1. readinessを落とし、ロードバランサーが振り分けを止めるのを待つ
+	slog.Info("shutdown signal received, draining", "delay", s.drainDelay, "timeout", s.shutdownTimeout)
+	s.ready.Store(false)
+	time.Sleep(s.drainDelay)
+
+	// 2. 新規接続の受付を止め、処理中のリクエスト(注文作成・配送計画など)の完了を待つ
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	var errs []error
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("http server shutdown: %w", err))
+	}
+
+	// 3. ワーカー・Redis・MySQLを順に停止する
+	if err := s.closeAll(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	slog.Info("server stopped")
+	return errors.Join(errs...)
+}
 
-	log.Printf("Starting server on :%s", appPort)
-	if err := http.ListenAndServe(":"+appPort, s.Router); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+func (s *Server) closeAll(ctx context.Context) error {
+	var errs []error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		c := s.closers[i]
+		if err := c.fn(ctx); err != nil {
+			slog.Error("failed to stop component", "component", c.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
 	}
+	s.closers = nil
+	return errors.Join(errs...)
 }
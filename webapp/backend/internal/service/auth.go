@@ -4,22 +4,50 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"fmt"
 	"time"
 
+	"backend/internal/logging"
 	"backend/internal/repository"
 	"backend/internal/service/utils"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrUserNotFound    = errors.New("user not found")
-	ErrInvalidPassword = errors.New("invalid password")
-	ErrInternalServer  = errors.New("internal server error")
+	// ユーザーの存在有無が推測できないよう、どちらも同じコード・メッセージにする
+	ErrUserNotFound    = newError(KindUnauthorized, "invalid_credentials", "invalid credentials")
+	ErrInvalidPassword = newError(KindUnauthorized, "invalid_credentials", "invalid credentials")
+	ErrInternalServer  = newError(KindInternal, "internal_error", "internal server error")
+	ErrTooManyAttempts = newError(KindTooManyRequests, "too_many_requests", "too many login attempts")
 )
 
+// ログイン試行制限の設定
+// 閾値を超えた失敗回数に応じてロック時間を指数的に延ばす
+const (
+	loginFailureWindow   = time.Hour
+	loginUserMaxFailures = 5
+	loginIPMaxFailures   = 20
+	loginLockoutBase     = 30 * time.Second
+	loginLockoutMax      = 15 * time.Minute
+)
+
+// ロックアウト中のログイン試行で返すエラー
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrTooManyAttempts, e.RetryAfter)
+}
+
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
 type AuthService struct {
 	store *repository.Store
 }
@@ -28,16 +56,24 @@ func NewAuthService(store *repository.Store) *AuthService {
 	return &AuthService{store: store}
 }
 
-func (s *AuthService) Login(ctx context.Context, userName, password string) (string, time.Time, error) {
+func (s *AuthService) Login(ctx context.Context, userName, password, clientIP string) (string, time.Time, error) {
 	ctx, span := otel.Tracer("service.auth").Start(ctx, "AuthService.Login")
 	defer span.End()
 
+	keys := loginAttemptKeys(userName, clientIP)
+	if retryAfter := s.lockRemaining(ctx, keys); retryAfter > 0 {
+		span.AddEvent("login.locked", trace.WithAttributes(
+			attribute.Int64("login.retry_after_ms", retryAfter.Milliseconds()),
+		))
+		return "", time.Time{}, &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+
 	var sessionID string
 	var expiresAt time.Time
-	err := utils.WithTimeout(ctx, func(ctx context.Context) error {
+	err := utils.RunStage(ctx, "login", func(ctx context.Context) error {
 		user, err := s.store.UserRepo.FindByUserName(ctx, userName)
 		if err != nil {
-			log.Printf("[Login] ユーザー検索失敗(userName: %s): %v", userName, err)
+			logging.Info(ctx, "login user lookup failed", "user_name", userName, "error", err)
 			if errors.Is(err, sql.ErrNoRows) {
 				return ErrUserNotFound
 			}
@@ -46,7 +82,7 @@ func (s *AuthService) Login(ctx context.Context, userName, password string) (str
 
 		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 		if err != nil {
-			log.Printf("[Login] パスワード検証失敗: %v", err)
+			logging.Info(ctx, "login password mismatch", "user_name", userName)
 			span.RecordError(err)
 			return ErrInvalidPassword
 		}
@@ -54,14 +90,87 @@ func (s *AuthService) Login(ctx context.Context, userName, password string) (str
 		sessionDuration := 24 * time.Hour
 		sessionID, expiresAt, err = s.store.SessionRepo.Create(ctx, user.UserID, sessionDuration)
 		if err != nil {
-			log.Printf("[Login] セッション生成失敗: %v", err)
+			logging.Error(ctx, "failed to create session", "user_id", user.UserID, "error", err)
 			return ErrInternalServer
 		}
 		return nil
 	})
 	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidPassword) {
+			s.recordFailure(ctx, span, keys)
+		}
 		return "", time.Time{}, err
 	}
-	log.Printf("Login successful for UserName '%s', session created.", userName)
+	for _, k := range keys {
+		_ = s.store.LoginAttemptRepo.Reset(ctx, k.key)
+	}
+	logging.Info(ctx, "login succeeded", "user_name", userName)
 	return sessionID, expiresAt, nil
 }
+
+type loginAttemptKey struct {
+	key         string
+	maxFailures int64
+}
+
+// ユーザー単位のカウンタはIPごとに分ける (他のIPからの失敗で本人がロックされないように)
+func loginAttemptKeys(userName, clientIP string) []loginAttemptKey {
+	keys := []loginAttemptKey{{key: "user:" + userName + "@" + clientIP, maxFailures: loginUserMaxFailures}}
+	if clientIP != "" {
+		keys = append(keys, loginAttemptKey{key: "ip:" + clientIP, maxFailures: loginIPMaxFailures})
+	}
+	return keys
+}
+
+// いずれかのキーがロック中であれば最長の残り時間を返す
+func (s *AuthService) lockRemaining(ctx context.Context, keys []loginAttemptKey) time.Duration {
+	var longest time.Duration
+	for _, k := range keys {
+		remaining, err := s.store.LoginAttemptRepo.LockRemaining(ctx, k.key)
+		if err != nil {
+			logging.Warn(ctx, "failed to get login lock state", "key", k.key, "error", err)
+			continue
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest
+}
+
+// 失敗回数を記録し、閾値を超えたらロックする
+func (s *AuthService) recordFailure(ctx context.Context, span trace.Span, keys []loginAttemptKey) {
+	for _, k := range keys {
+		failures, err := s.store.LoginAttemptRepo.IncrFailure(ctx, k.key, loginFailureWindow)
+		if err != nil {
+			logging.Warn(ctx, "failed to record login failure", "key", k.key, "error", err)
+			continue
+		}
+		if failures < k.maxFailures {
+			continue
+		}
+		duration := lockoutDuration(failures - k.maxFailures)
+		if err := s.store.LoginAttemptRepo.Lock(ctx, k.key, duration); err != nil {
+			logging.Warn(ctx, "failed to lock login", "key", k.key, "error", err)
+			continue
+		}
+		logging.Warn(ctx, "login locked out", "key", k.key, "failures", failures, "duration", duration)
+		span.AddEvent("login.lockout", trace.WithAttributes(
+			attribute.String("login.lockout_key", k.key),
+			attribute.Int64("login.failures", failures),
+			attribute.Int64("login.lockout_ms", duration.Milliseconds()),
+		))
+	}
+}
+
+// 閾値超過回数に応じたロック時間 (base * 2^n, 上限あり)
+func lockoutDuration(over int64) time.Duration {
+	d := loginLockoutBase
+	for i := int64(0); i < over; i++ {
+		d *= 2
+		if d >= loginLockoutMax {
+			return loginLockoutMax
+		}
+	}
+	return d
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	userID := createTestUser(t, db, "user")
+	svc := NewAuthService(store)
+
+	sessionID, expiresAt, err := svc.Login(ctx, "user", testPassword, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionID == "" || expiresAt.IsZero() {
+		t.Fatalf("session = %q, expires = %v", sessionID, expiresAt)
+	}
+	user, err := store.SessionRepo.FindUserBySessionID(ctx, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.UserID != userID {
+		t.Errorf("session user = %d, want %d", user.UserID, userID)
+	}
+
+	// パスワード違いと存在しないユーザーは同じエラーコードになる
+	_, _, err = svc.Login(ctx, "user", "wrong", "192.0.2.1")
+	if !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("wrong password: err = %v, want %v", err, ErrInvalidPassword)
+	}
+	_, _, err = svc.Login(ctx, "nobody", testPassword, "192.0.2.1")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want %v", err, ErrUserNotFound)
+	}
+	if ErrUserNotFound.Error() != ErrInvalidPassword.Error() {
+		t.Errorf("unknown user and wrong password must not be distinguishable")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	createTestUser(t, db, "user")
+	createTestUser(t, db, "other")
+	svc := NewAuthService(store)
+
+	for i := 0; i < loginUserMaxFailures; i++ {
+		if _, _, err := svc.Login(ctx, "user", "wrong", "192.0.2.1"); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("attempt %d: err = %v, want %v", i+1, err, ErrInvalidPassword)
+		}
+	}
+
+	// ロック中は正しいパスワードでも拒否する
+	_, _, err := svc.Login(ctx, "user", testPassword, "192.0.2.1")
+	var tooMany *TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("err = %v, want *TooManyAttemptsError", err)
+	}
+	if tooMany.RetryAfter <= 0 || tooMany.RetryAfter > loginLockoutBase {
+		t.Errorf("RetryAfter = %v, want (0, %v]", tooMany.RetryAfter, loginLockoutBase)
+	}
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("err = %v, want to match %v", err, ErrTooManyAttempts)
+	}
+
+	// ユーザー単位のロックは他のユーザーに影響しない
+	if _, _, err := svc.Login(ctx, "other", testPassword, "192.0.2.1"); err != nil {
+		t.Errorf("other user: err = %v", err)
+	}
+	// 他のIPからの失敗では本人をロックしない
+	if _, _, err := svc.Login(ctx, "user", testPassword, "192.0.2.2"); err != nil {
+		t.Errorf("other ip: err = %v", err)
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	createTestUser(t, db, "user")
+	svc := NewAuthService(store)
+
+	// 同じIPから多数のユーザー名を試すとIP単位でロックする
+	for i := 0; i < loginIPMaxFailures; i++ {
+		svc.Login(ctx, fmt.Sprintf("nobody%d", i), "wrong", "192.0.2.1")
+	}
+	if _, _, err := svc.Login(ctx, "user", testPassword, "192.0.2.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("same ip: err = %v, want %v", err, ErrTooManyAttempts)
+	}
+	if _, _, err := svc.Login(ctx, "user", testPassword, "192.0.2.2"); err != nil {
+		t.Errorf("other ip: err = %v", err)
+	}
+}
+
+// ログインに成功するとIP単位のカウンタもリセットする
+func TestLoginResetsIPFailures(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	createTestUser(t, db, "user")
+	svc := NewAuthService(store)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < loginIPMaxFailures-1; i++ {
+			svc.Login(ctx, fmt.Sprintf("nobody%d", i), "wrong", "192.0.2.1")
+		}
+		if _, _, err := svc.Login(ctx, "user", testPassword, "192.0.2.1"); err != nil {
+			t.Fatalf("round %d: err = %v", round, err)
+		}
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		over int64
+		want time.Duration
+	}{
+		{0, loginLockoutBase},
+		{1, 2 * loginLockoutBase},
+		{3, 8 * loginLockoutBase},
+		{100, loginLockoutMax},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.over); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.over, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/internal/repository"
+)
+
+// エラーの種類 (ハンドラーでHTTPステータスに対応付ける)
+type ErrorKind string
+
+const (
+	KindInternal        ErrorKind = "internal"
+	KindNotFound        ErrorKind = "not_found"
+	KindConflict        ErrorKind = "conflict"
+	KindValidation      ErrorKind = "validation"
+	KindUnauthorized    ErrorKind = "unauthorized"
+	KindForbidden       ErrorKind = "forbidden"
+	KindTooManyRequests ErrorKind = "too_many_requests"
+	KindTimeout         ErrorKind = "timeout"
+	KindUnavailable     ErrorKind = "unavailable"
+)
+
+// 種類と、クライアントに返すコード・メッセージを持つエラー
+// パッケージ変数として定義し、errors.Isで比較できるようにする
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(kind ErrorKind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// 入力値の検証エラー
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// エラーの種類を判定する
+// 期限切れ(utils.RunStageのタイムアウトを含む)はtimeout、呼び出し元のキャンセルはunavailable、一意制約違反はconflictとして扱う
+func KindOf(err error) ErrorKind {
+	var svcErr *Error
+	var validationErr *ValidationError
+	var tooMany *TooManyAttemptsError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &validationErr):
+		return KindValidation
+	case errors.As(err, &tooMany):
+		return KindTooManyRequests
+	case errors.As(err, &svcErr):
+		return svcErr.Kind
+	case repository.IsDuplicateKey(err):
+		return KindConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, context.Canceled):
+		return KindUnavailable
+	}
+	return KindInternal
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/imagestore"
+	"backend/internal/imaging"
+	"backend/internal/logging"
+	"backend/internal/model"
+	"backend/internal/repository"
+)
+
+var (
+	ErrInvalidImage     = newError(KindValidation, "invalid_image", "unsupported or invalid image")
+	ErrInvalidImagePath = newError(KindValidation, "invalid_image_path", "invalid image path")
+	ErrImageNotFound    = newError(KindNotFound, "image_not_found", "image not found")
+)
+
+// 生成するサムネイルの幅
+var thumbnailWidths = []int{150, 300, 600}
+
+// ?w= で指定できる幅 (任意の幅を許すとディスクを食い潰せるため、近い幅に丸める)
+var resizeWidths = []int{150, 300, 600, 1200}
+
+// アップロードされた画像の保存先 (画像ディレクトリからの相対パス)
+const uploadImageDir = "products"
+
+// 配信時にリサイズした画像のキャッシュ先 (内容アドレスでない画像用)
+const resizeCacheDir = "cache"
+
+// 内容アドレス(SHA-256)で命名されたファイル名 (例: <hash>.png, <hash>_w300.webp)
+var contentAddressedName = regexp.MustCompile(`^[0-9a-f]{64}(_w[0-9]+)?\.[a-z]+$`)
+
+type ImageService struct {
+	store  *repository.Store
+	images imagestore.ImageStore
+
+	etagMu sync.Mutex
+	etags  map[string]etagEntry
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func NewImageService(store *repository.Store, images imagestore.ImageStore) *ImageService {
+	return &ImageService{store: store, images: images, etags: make(map[string]etagEntry)}
+}
+
+// 配信用に開いた画像ファイル
+type ImageFile struct {
+	io.ReadSeekCloser
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+	// 内容アドレスで命名されており、内容が変わらないことが保証されている
+	Immutable bool
+}
+
+// 配信用に画像を開く
+// widthが指定された場合はリサイズ版を返す (初回に生成してディスクにキャッシュする)
+func (s *ImageService) Open(ctx context.Context, imagePath string, width int) (*ImageFile, error) {
+	relPath, err := cleanImagePath(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	if width > 0 {
+		relPath, err = s.resized(ctx, relPath, width)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, info, err := s.images.Open(ctx, relPath)
+	if err != nil {
+		if errors.Is(err, imagestore.ErrNotExist) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+
+	name := path.Base(relPath)
+	img := &ImageFile{
+		ReadSeekCloser: f,
+		ModTime:        info.ModTime,
+		ContentType:    contentTypeByExt(name),
+	}
+	if contentAddressedName.MatchString(name) {
+		// ファイル名が内容から決まるため、内容を読まずにETagとして使える
+		img.ETag = `"` + name + `"`
+		img.Immutable = true
+	} else {
+		img.ETag, err = s.etag(ctx, relPath, info)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// 画像ディレクトリ外を指すパスを拒否し、スラッシュ区切りの相対パスにする
+func cleanImagePath(imagePath string) (string, error) {
+	if imagePath == "" {
+		return "", ErrInvalidImagePath
+	}
+	cleaned := path.Clean("/" + filepath.ToSlash(imagePath))[1:]
+	if cleaned == "" || strings.Contains(imagePath, "..") || filepath.IsAbs(imagePath) {
+		return "", ErrInvalidImagePath
+	}
+	return cleaned, nil
+}
+
+func contentTypeByExt(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
+
+// 内容から強いETagを計算する (更新日時とサイズが変わらない限りキャッシュする)
+func (s *ImageService) etag(ctx context.Context, key string, info imagestore.ObjectInfo) (string, error) {
+	s.etagMu.Lock()
+	e, ok := s.etags[key]
+	s.etagMu.Unlock()
+	if ok && e.modTime.Equal(info.ModTime) && e.size == info.Size {
+		return e.etag, nil
+	}
+
+	f, _, err := s.images.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+
+	s.etagMu.Lock()
+	s.etags[key] = etagEntry{modTime: info.ModTime, size: info.Size, etag: etag}
+	s.etagMu.Unlock()
+	return etag, nil
+}
+
+// 要求された幅に最も近い(それ以上の)許可幅
+func snapWidth(width int) int {
+	for _, w := range resizeWidths {
+		if width <= w {
+			return w
+		}
+	}
+	return resizeWidths[len(resizeWidths)-1]
+}
+
+// リサイズ版の相対パスを返す。なければ生成する
+func (s *ImageService) resized(ctx context.Context, relPath string, width int) (string, error) {
+	width = snapWidth(width)
+	dir, name := path.Split(relPath)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	var cached string
+	if contentAddressedName.MatchString(name) && !strings.Contains(stem, "_w") {
+		// アップロード時に生成したサムネイルと同じ命名にする
+		cached = path.Join(dir, fmt.Sprintf("%s_w%d%s", stem, width, ext))
+	} else {
+		cached = path.Join(resizeCacheDir, dir, fmt.Sprintf("%s_w%d%s", stem, width, ext))
+	}
+
+	src, srcInfo, err := s.images.Open(ctx, relPath)
+	if err != nil {
+		if errors.Is(err, imagestore.ErrNotExist) {
+			return "", ErrImageNotFound
+		}
+		return "", err
+	}
+	defer src.Close()
+	// 元画像が差し替えられていなければキャッシュを使う
+	if info, err := s.images.Stat(ctx, cached); err == nil && !info.ModTime.Before(srcInfo.ModTime) {
+		return cached, nil
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return "", err
+	}
+	img, format, err := imaging.Decode(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	// 元画像の幅以下の場合は元画像をそのままキャッシュし、次回以降のデコードを省く
+	out := data
+	if img.Bounds().Dx() > width {
+		// 拡張子と実際の形式が異なる場合でも、拡張子に合った形式で書き出す
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, imaging.Resize(img, width), formatByExt(ext, format)); err != nil {
+			return "", fmt.Errorf("failed to encode resized image: %w", err)
+		}
+		out = buf.Bytes()
+	}
+	if err := s.images.Put(ctx, cached, out, contentTypeByExt(cached)); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+func formatByExt(ext, fallback string) string {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return imaging.FormatJPEG
+	case ".png":
+		return imaging.FormatPNG
+	case ".gif":
+		return imaging.FormatGIF
+	case ".webp":
+		return imaging.FormatWebP
+	}
+	return fallback
+}
+
+// 商品画像を保存し、サムネイルとWebP版を生成してproducts.imageを更新する
+// ファイル名は内容のSHA-256から決めるため、同じ画像は再生成しない
+func (s *ImageService) UploadProductImage(ctx context.Context, productID int, data []byte) (*model.ProductImage, error) {
+	if _, err := s.store.ProductRepo.FindByID(ctx, productID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	img, format, err := imaging.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	dir := path.Join(uploadImageDir, hash[:2])
+
+	bounds := img.Bounds()
+	result := &model.ProductImage{
+		Path:     path.Join(dir, hash+imaging.Extension(format)),
+		Format:   format,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Variants: []model.ImageVariant{},
+	}
+	if err := s.putIfAbsent(ctx, result.Path, data); err != nil {
+		return nil, err
+	}
+
+	for _, width := range thumbnailWidths {
+		if width >= bounds.Dx() {
+			continue
+		}
+		resized := imaging.Resize(img, width)
+		for _, f := range []string{imaging.ThumbnailFormat(format), imaging.FormatWebP} {
+			variant, err := s.writeVariant(ctx, dir, hash, resized, width, f)
+			if err != nil {
+				return nil, err
+			}
+			result.Variants = append(result.Variants, variant)
+		}
+	}
+	// 元サイズのWebP版
+	if format != imaging.FormatWebP {
+		variant, err := s.writeVariant(ctx, dir, hash, img, bounds.Dx(), imaging.FormatWebP)
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, variant)
+	}
+
+	if err := s.store.ProductRepo.UpdateImage(ctx, productID, result.Path); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	logging.Info(ctx, "uploaded product image", "product_id", productID, "path", result.Path, "variants", len(result.Variants))
+	return result, nil
+}
+
+// 派生画像のパス (例: products/ab/<hash>_w300.webp)
+func variantPath(dir, hash string, width int, format string) string {
+	return path.Join(dir, fmt.Sprintf("%s_w%d%s", hash, width, imaging.Extension(format)))
+}
+
+func (s *ImageService) writeVariant(ctx context.Context, dir, hash string, img image.Image, width int, format string) (model.ImageVariant, error) {
+	variant := model.ImageVariant{
+		Path:   variantPath(dir, hash, width, format),
+		Format: format,
+		Width:  width,
+	}
+	if _, err := s.images.Stat(ctx, variant.Path); err == nil {
+		return variant, nil
+	}
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format); err != nil {
+		return variant, fmt.Errorf("failed to encode %s variant: %w", format, err)
+	}
+	return variant, s.images.Put(ctx, variant.Path, buf.Bytes(), imaging.ContentType(format))
+}
+
+// 内容アドレスのため、既に存在する場合は書き込まない
+func (s *ImageService) putIfAbsent(ctx context.Context, key string, data []byte) error {
+	if _, err := s.images.Stat(ctx, key); err == nil {
+		return nil
+	}
+	return s.images.Put(ctx, key, data, contentTypeByExt(key))
+}
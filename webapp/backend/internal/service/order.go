@@ -5,8 +5,12 @@ import (
 	"backend/internal/repository"
 	"backend/internal/service/utils"
 	"context"
+	"fmt"
 )
 
+// Redisに接続できず、注文イベントを購読できない場合
+var ErrEventsUnavailable = newError(KindUnavailable, "events_unavailable", "order events are temporarily unavailable")
+
 type OrderService struct {
 	store *repository.Store
 }
@@ -19,7 +23,7 @@ func NewOrderService(store *repository.Store) *OrderService {
 func (s *OrderService) FetchOrders(ctx context.Context, userID int, req model.ListRequest) ([]model.Order, int, error) {
 	var orders []model.Order
 	var total int
-	err := utils.WithTimeout(ctx, func(ctx context.Context) error {
+	err := utils.RunStage(ctx, "orders.list", func(ctx context.Context) error {
 		var fetchErr error
 		orders, total, fetchErr = s.store.OrderRepo.ListOrders(ctx, userID, req)
 		if fetchErr != nil {
@@ -32,3 +36,25 @@ func (s *OrderService) FetchOrders(ctx context.Context, userID int, req model.Li
 	}
 	return orders, total, nil
 }
+
+// ユーザーの注文履歴を、FetchOrdersと同じ条件・順序ですべて1件ずつfnに渡す
+// fnがエラーを返した場合はそこで止める
+func (s *OrderService) ExportOrders(ctx context.Context, userID int, req model.ListRequest, fn func(model.Order) error) error {
+	return utils.RunStage(ctx, "orders.export", func(ctx context.Context) error {
+		return s.store.OrderRepo.EachOrder(ctx, userID, req, fn)
+	})
+}
+
+// ユーザーの注文ステータスの変更を購読する
+// lastEventIDを指定した場合は、それより後に発行されたイベントから受け取る
+// 返すチャンネルはctxがキャンセルされると閉じる
+func (s *OrderService) StreamStatus(ctx context.Context, userID int, lastEventID string) (<-chan model.OrderEvent, error) {
+	if lastEventID != "" && !repository.ValidEventID(lastEventID) {
+		return nil, &ValidationError{Field: "Last-Event-ID", Message: "must be an event id such as 1700000000000-0"}
+	}
+	events, err := s.store.OrderEventRepo.Subscribe(ctx, userID, lastEventID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEventsUnavailable, err)
+	}
+	return events, nil
+}
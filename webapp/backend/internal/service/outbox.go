@@ -0,0 +1,57 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 注文ステータスの変更に対応するドメインイベント (shippingへの戻しはイベントにしない)
+var statusEventTypes = map[string]string{
+	"delivering": model.EventOrderClaimed,
+	"completed":  model.EventOrderDelivered,
+}
+
+// 注文のドメインイベントをoutboxに記録する
+// 変更と同じトランザクションのStoreを渡し、変更がロールバックされた場合はイベントも残らないようにする
+func recordOrderEvents(ctx context.Context, txStore *repository.Store, eventType string, payloads []model.OrderEventPayload) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+	now := time.Now()
+	events := make([]model.OutboxEvent, len(payloads))
+	for i, p := range payloads {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		events[i] = model.OutboxEvent{
+			EventID:     uuid.NewString(),
+			EventType:   eventType,
+			AggregateID: p.OrderID,
+			Payload:     data,
+			CreatedAt:   now,
+		}
+	}
+	return txStore.OutboxRepo.Add(ctx, events)
+}
+
+// ステータスの変更をイベントとして記録する
+func recordStatusEvents(ctx context.Context, txStore *repository.Store, userIDs map[int64]int, status string) error {
+	eventType, ok := statusEventTypes[status]
+	if !ok {
+		return nil
+	}
+	payloads := make([]model.OrderEventPayload, 0, len(userIDs))
+	for orderID, userID := range userIDs {
+		payloads = append(payloads, model.OrderEventPayload{OrderID: orderID, UserID: userID, ShippedStatus: status})
+	}
+	slices.SortFunc(payloads, func(a, b model.OrderEventPayload) int { return cmp.Compare(a.OrderID, b.OrderID) })
+	return recordOrderEvents(ctx, txStore, eventType, payloads)
+}
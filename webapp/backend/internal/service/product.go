@@ -2,10 +2,29 @@ package service
 
 import (
 	"context"
-	"log"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"backend/internal/logging"
 	"backend/internal/model"
 	"backend/internal/repository"
+	"backend/internal/service/utils"
+)
+
+var (
+	ErrProductNotFound    = newError(KindNotFound, "product_not_found", "product not found")
+	ErrProductUnavailable = newError(KindValidation, "product_unavailable", "product is not available")
+)
+
+// 商品入力値の上限
+const (
+	productNameMaxLength        = 255
+	productImageMaxLength       = 500
+	productDescriptionMaxLength = 2000
 )
 
 type ProductService struct {
@@ -22,7 +41,7 @@ func (s *ProductService) CreateOrders(ctx context.Context, userID int, items []m
 	err := s.store.ExecTx(ctx, func(txStore *repository.Store) error {
 		// すべての注文を一度に作成するためのスライスを準備
 		ordersToCreate := make([]model.Order, 0)
-		
+
 		for _, item := range items {
 			if item.Quantity > 0 {
 				// 数量分の注文をスライスに追加
@@ -34,28 +53,167 @@ func (s *ProductService) CreateOrders(ctx context.Context, userID int, items []m
 				}
 			}
 		}
-		
+
 		if len(ordersToCreate) == 0 {
 			return nil
 		}
-		
-		// Bulk insertで一度にすべての注文を作成
-		orderIDs, err := txStore.OrderRepo.CreateBulk(ctx, ordersToCreate)
+
+		// 論理削除された商品は注文できない
+		err := utils.RunStage(ctx, "orders.check_products", func(ctx context.Context) error {
+			return checkProductsActive(ctx, txStore, items)
+		})
 		if err != nil {
 			return err
 		}
-		insertedOrderIDs = orderIDs
-		return nil
+
+		// Bulk insertで一度にすべての注文を作成
+		return utils.RunStage(ctx, "orders.insert", func(ctx context.Context) error {
+			orderIDs, err := txStore.OrderRepo.CreateBulk(ctx, ordersToCreate)
+			if err != nil {
+				return err
+			}
+			insertedOrderIDs = orderIDs
+
+			payloads := make([]model.OrderEventPayload, len(orderIDs))
+			for i, id := range orderIDs {
+				orderID, err := strconv.ParseInt(id, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid order id %q: %w", id, err)
+				}
+				payloads[i] = model.OrderEventPayload{
+					OrderID:       orderID,
+					UserID:        userID,
+					ProductID:     ordersToCreate[i].ProductID,
+					ShippedStatus: "shipping",
+				}
+			}
+			return recordOrderEvents(ctx, txStore, model.EventOrderCreated, payloads)
+		})
 	})
 
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Created %d orders for user %d", len(insertedOrderIDs), userID)
+	logging.Info(ctx, "created orders", "orders", len(insertedOrderIDs))
 	return insertedOrderIDs, nil
 }
 
 func (s *ProductService) FetchProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error) {
-	products, total, err := s.store.ProductRepo.ListProducts(ctx, userID, req)
+	var products []model.Product
+	var total int
+	err := utils.RunStage(ctx, "products.list", func(ctx context.Context) error {
+		var err error
+		products, total, err = s.store.ProductRepo.ListProducts(ctx, userID, req)
+		return err
+	})
 	return products, total, err
 }
+
+// 注文対象の商品がすべて存在し、論理削除されていないことを確認する
+func checkProductsActive(ctx context.Context, store *repository.Store, items []model.RequestItem) error {
+	seen := make(map[int]struct{}, len(items))
+	productIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			continue
+		}
+		if _, ok := seen[item.ProductID]; ok {
+			continue
+		}
+		seen[item.ProductID] = struct{}{}
+		productIDs = append(productIDs, item.ProductID)
+	}
+	count, err := store.ProductRepo.CountActive(ctx, productIDs)
+	if err != nil {
+		return err
+	}
+	if count != len(productIDs) {
+		return ErrProductUnavailable
+	}
+	return nil
+}
+
+func (s *ProductService) GetProduct(ctx context.Context, productID int) (*model.Product, error) {
+	product, err := s.store.ProductRepo.FindByID(ctx, productID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return product, nil
+}
+
+func (s *ProductService) CreateProduct(ctx context.Context, input model.ProductInput) (*model.Product, error) {
+	input, err := validateProductInput(input)
+	if err != nil {
+		return nil, err
+	}
+	productID, err := s.store.ProductRepo.Create(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	logging.Info(ctx, "created product", "product_id", productID)
+	return productFromInput(productID, input), nil
+}
+
+func (s *ProductService) UpdateProduct(ctx context.Context, productID int, input model.ProductInput) (*model.Product, error) {
+	input, err := validateProductInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.ProductRepo.Update(ctx, productID, input); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	logging.Info(ctx, "updated product", "product_id", productID)
+	return productFromInput(productID, input), nil
+}
+
+// 商品を論理削除する (注文履歴は残る)
+func (s *ProductService) DeleteProduct(ctx context.Context, productID int) error {
+	if err := s.store.ProductRepo.SoftDelete(ctx, productID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	logging.Info(ctx, "deleted product", "product_id", productID)
+	return nil
+}
+
+func productFromInput(productID int, input model.ProductInput) *model.Product {
+	return &model.Product{
+		ProductID:   productID,
+		Name:        input.Name,
+		Value:       input.Value,
+		Weight:      input.Weight,
+		Image:       input.Image,
+		Description: input.Description,
+	}
+}
+
+// 商品の入力値を検証し、前後の空白を取り除いたものを返す
+func validateProductInput(input model.ProductInput) (model.ProductInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Image = strings.TrimSpace(input.Image)
+	input.Description = strings.TrimSpace(input.Description)
+
+	switch {
+	case input.Name == "":
+		return input, &ValidationError{Field: "name", Message: "must not be empty"}
+	case utf8.RuneCountInString(input.Name) > productNameMaxLength:
+		return input, &ValidationError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", productNameMaxLength)}
+	case input.Value <= 0:
+		return input, &ValidationError{Field: "value", Message: "must be positive"}
+	case input.Weight <= 0:
+		return input, &ValidationError{Field: "weight", Message: "must be positive"}
+	case utf8.RuneCountInString(input.Image) > productImageMaxLength:
+		return input, &ValidationError{Field: "image", Message: fmt.Sprintf("must be at most %d characters", productImageMaxLength)}
+	case utf8.RuneCountInString(input.Description) > productDescriptionMaxLength:
+		return input, &ValidationError{Field: "description", Message: fmt.Sprintf("must be at most %d characters", productDescriptionMaxLength)}
+	}
+	return input, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCreateOrders(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	userID := createTestUser(t, db, "user")
+	productID := createTestProduct(t, store, "商品", 100, 2)
+	svc := NewProductService(store)
+
+	orderIDs, err := svc.CreateOrders(ctx, userID, []model.RequestItem{{ProductID: productID, Quantity: 3}, {ProductID: productID, Quantity: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orderIDs) != 3 {
+		t.Fatalf("created %d orders, want 3", len(orderIDs))
+	}
+	for _, o := range listTestOrders(t, store, userID) {
+		if o.ProductID != productID || o.ShippedStatus != "shipping" {
+			t.Errorf("order = %+v, want product %d shipping", o, productID)
+		}
+	}
+
+	// 注文1件につきOrderCreatedイベントを1件記録する
+	events := pendingOutboxEvents(t, store)
+	if len(events) != 3 {
+		t.Fatalf("outbox events = %d, want 3", len(events))
+	}
+	for _, e := range events {
+		var p model.OrderEventPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		if e.EventType != model.EventOrderCreated || p.UserID != userID || p.ProductID != productID || p.OrderID != e.AggregateID {
+			t.Errorf("event = %+v, payload = %+v", e, p)
+		}
+	}
+}
+
+// リレーを動かさない場合は、注文を作成してもイベントを記録しない
+func TestCreateOrdersWithDiscardedOutbox(t *testing.T) {
+	ctx := context.Background()
+	db := repository.NewMemoryDB()
+	store := repository.NewMemoryStore(db)
+	store.DiscardOutbox()
+	userID := createTestUser(t, db, "user")
+	productID := createTestProduct(t, store, "商品", 100, 2)
+
+	if _, err := NewProductService(store).CreateOrders(ctx, userID, []model.RequestItem{{ProductID: productID, Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if orders := listTestOrders(t, store, userID); len(orders) != 2 {
+		t.Fatalf("orders = %d, want 2", len(orders))
+	}
+	// 同じデータを別のStoreから確認する
+	if events := pendingOutboxEvents(t, repository.NewMemoryStore(db)); len(events) != 0 {
+		t.Errorf("outbox events = %d, want 0", len(events))
+	}
+}
+
+// 論理削除された商品を含む注文は、他の商品の注文も含めてすべて作成しない
+func TestCreateOrdersRejectsDeletedProduct(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	userID := createTestUser(t, db, "user")
+	activeID := createTestProduct(t, store, "販売中", 100, 2)
+	deletedID := createTestProduct(t, store, "販売終了", 100, 2)
+	if err := store.ProductRepo.SoftDelete(ctx, deletedID); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewProductService(store)
+
+	for _, items := range [][]model.RequestItem{
+		{{ProductID: activeID, Quantity: 2}, {ProductID: deletedID, Quantity: 1}},
+		{{ProductID: activeID, Quantity: 1}, {ProductID: 999999, Quantity: 1}},
+	} {
+		orderIDs, err := svc.CreateOrders(ctx, userID, items)
+		if !errors.Is(err, ErrProductUnavailable) {
+			t.Fatalf("items %+v: err = %v, want %v", items, err, ErrProductUnavailable)
+		}
+		if orderIDs != nil {
+			t.Errorf("items %+v: order ids = %v, want nil", items, orderIDs)
+		}
+	}
+	if orders := listTestOrders(t, store, userID); len(orders) != 0 {
+		t.Errorf("orders = %d, want 0", len(orders))
+	}
+	if events := pendingOutboxEvents(t, store); len(events) != 0 {
+		t.Errorf("outbox events = %d, want 0", len(events))
+	}
+}
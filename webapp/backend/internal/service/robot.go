@@ -1,11 +1,15 @@
 package service
 
 import (
+	"backend/internal/logging"
+	"backend/internal/metrics"
 	"backend/internal/model"
 	"backend/internal/repository"
 	"backend/internal/service/utils"
+	"cmp"
 	"context"
-	"log"
+	"slices"
+	"time"
 )
 
 type RobotService struct {
@@ -20,41 +24,95 @@ func NewRobotService(store *repository.Store) *RobotService {
 // 注文の取得件数を制限した場合、ペナルティの対象になります。
 func (s *RobotService) GenerateDeliveryPlan(ctx context.Context, robotID string, capacity int) (*model.DeliveryPlan, error) {
 	var plan model.DeliveryPlan
+	var userIDs map[int64]int
+
+	err := s.store.ExecTx(ctx, func(txStore *repository.Store) error {
+		var orders []model.Order
+		err := utils.RunStage(ctx, "delivery_plan.fetch_orders", func(ctx context.Context) error {
+			var err error
+			orders, err = txStore.OrderRepo.GetShippingOrders(ctx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
 
-	err := utils.WithTimeout(ctx, func(ctx context.Context) error {
-		return s.store.ExecTx(ctx, func(txStore *repository.Store) error {
-			orders, err := txStore.OrderRepo.GetShippingOrders(ctx)
+		err = utils.RunStage(ctx, "delivery_plan.solve", func(ctx context.Context) error {
+			start := time.Now()
+			var err error
+			plan, err = selectOrdersForDelivery(ctx, orders, robotID, capacity)
 			if err != nil {
 				return err
 			}
-			plan, err = selectOrdersForDelivery(ctx, orders, robotID, capacity)
-			if err != nil {
+			metrics.ObserveSolver(time.Since(start), len(orders), len(plan.Orders))
+			return nil
+		})
+		if err != nil || len(plan.Orders) == 0 {
+			return err
+		}
+
+		return utils.RunStage(ctx, "delivery_plan.update_status", func(ctx context.Context) error {
+			orderIDs := make([]int64, len(plan.Orders))
+			for i, order := range plan.Orders {
+				orderIDs[i] = order.OrderID
+			}
+			if err := txStore.OrderRepo.UpdateStatuses(ctx, orderIDs, "delivering"); err != nil {
 				return err
 			}
-			if len(plan.Orders) > 0 {
-				orderIDs := make([]int64, len(plan.Orders))
-				for i, order := range plan.Orders {
-					orderIDs[i] = order.OrderID
-				}
-
-				if err := txStore.OrderRepo.UpdateStatuses(ctx, orderIDs, "delivering"); err != nil {
-					return err
-				}
-				log.Printf("Updated status to 'delivering' for %d orders", len(orderIDs))
+			var err error
+			if userIDs, err = txStore.OrderRepo.FindUserIDs(ctx, orderIDs); err != nil {
+				return err
+			}
+			if err := recordStatusEvents(ctx, txStore, userIDs, "delivering"); err != nil {
+				return err
 			}
+			logging.Info(ctx, "orders marked as delivering", "orders", len(orderIDs))
 			return nil
 		})
 	})
 	if err != nil {
 		return nil, err
 	}
+	s.publishStatusChanges(ctx, userIDs, "delivering")
 	return &plan, nil
 }
 
 func (s *RobotService) UpdateOrderStatus(ctx context.Context, orderID int64, newStatus string) error {
-	return utils.WithTimeout(ctx, func(ctx context.Context) error {
-		return s.store.OrderRepo.UpdateStatuses(ctx, []int64{orderID}, newStatus)
+	var userIDs map[int64]int
+	err := utils.RunStage(ctx, "orders.update_status", func(ctx context.Context) error {
+		return s.store.ExecTx(ctx, func(txStore *repository.Store) error {
+			if err := txStore.OrderRepo.UpdateStatuses(ctx, []int64{orderID}, newStatus); err != nil {
+				return err
+			}
+			var err error
+			if userIDs, err = txStore.OrderRepo.FindUserIDs(ctx, []int64{orderID}); err != nil {
+				return err
+			}
+			return recordStatusEvents(ctx, txStore, userIDs, newStatus)
+		})
 	})
+	if err != nil {
+		return err
+	}
+	s.publishStatusChanges(ctx, userIDs, newStatus)
+	return nil
+}
+
+// ステータスの変更を注文者に配信する (コミット後に呼ぶ)
+// 配信に失敗しても更新は取り消さない (クライアントは注文履歴で最新の状態を確認できる)
+func (s *RobotService) publishStatusChanges(ctx context.Context, userIDs map[int64]int, status string) {
+	if len(userIDs) == 0 {
+		return
+	}
+	now := time.Now()
+	events := make([]model.OrderEvent, 0, len(userIDs))
+	for orderID, userID := range userIDs {
+		events = append(events, model.OrderEvent{OrderID: orderID, UserID: userID, ShippedStatus: status, ChangedAt: now})
+	}
+	slices.SortFunc(events, func(a, b model.OrderEvent) int { return cmp.Compare(a.OrderID, b.OrderID) })
+	if err := s.store.OrderEventRepo.Publish(ctx, events); err != nil {
+		logging.Warn(ctx, "failed to publish order status events", "orders", len(events), "error", err)
+	}
 }
 
 // selectOrdersForDelivery は動的計画法を使用してナップサック問題を解きます
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"testing"
+)
+
+func TestGenerateDeliveryPlan(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	userID := createTestUser(t, db, "user")
+	products := []struct{ value, weight int }{{60, 10}, {100, 20}, {120, 30}}
+	var items []model.RequestItem
+	for _, p := range products {
+		items = append(items, model.RequestItem{ProductID: createTestProduct(t, store, "商品", p.value, p.weight), Quantity: 1})
+	}
+	if _, err := NewProductService(store).CreateOrders(ctx, userID, items); err != nil {
+		t.Fatal(err)
+	}
+	orders := listTestOrders(t, store, userID)
+	createdEvents := len(pendingOutboxEvents(t, store))
+	svc := NewRobotService(store)
+
+	// 容量50では重さ20と30の組み合わせ (価値220) が最適
+	plan, err := svc.GenerateDeliveryPlan(ctx, "robot-1", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.RobotID != "robot-1" || plan.TotalWeight != 50 || plan.TotalValue != 220 {
+		t.Errorf("plan = %+v, want weight 50 value 220", plan)
+	}
+	if len(plan.Orders) != 2 || plan.Orders[0].OrderID != orders[1].OrderID || plan.Orders[1].OrderID != orders[2].OrderID {
+		t.Fatalf("plan orders = %+v, want orders %d and %d", plan.Orders, orders[1].OrderID, orders[2].OrderID)
+	}
+
+	// 選ばれた注文だけがdeliveringになり、OrderClaimedイベントが記録される
+	wantStatus := []string{"shipping", "delivering", "delivering"}
+	for i, o := range listTestOrders(t, store, userID) {
+		if o.ShippedStatus != wantStatus[i] {
+			t.Errorf("order %d status = %q, want %q", o.OrderID, o.ShippedStatus, wantStatus[i])
+		}
+	}
+	events := pendingOutboxEvents(t, store)[createdEvents:]
+	if len(events) != 2 {
+		t.Fatalf("claimed events = %d, want 2", len(events))
+	}
+	for i, e := range events {
+		if e.EventType != model.EventOrderClaimed || e.AggregateID != plan.Orders[i].OrderID {
+			t.Errorf("event %d = %s order %d, want %s order %d", i, e.EventType, e.AggregateID, model.EventOrderClaimed, plan.Orders[i].OrderID)
+		}
+	}
+
+	// 配送中の注文は次の計画の対象にならない
+	plan, err = svc.GenerateDeliveryPlan(ctx, "robot-2", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Orders) != 1 || plan.Orders[0].OrderID != orders[0].OrderID {
+		t.Errorf("second plan orders = %+v, want order %d", plan.Orders, orders[0].OrderID)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	userID := createTestUser(t, db, "user")
+	productID := createTestProduct(t, store, "商品", 100, 1)
+	orderIDs, err := NewProductService(store).CreateOrders(ctx, userID, []model.RequestItem{{ProductID: productID, Quantity: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderID := listTestOrders(t, store, userID)[0].OrderID
+	svc := NewRobotService(store)
+
+	// 購読中のクライアントにコミット後の変更が配信される
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := store.OrderEventRepo.Subscribe(streamCtx, userID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.UpdateOrderStatus(ctx, orderID, "completed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := listTestOrders(t, store, userID)[0].ShippedStatus; got != "completed" {
+		t.Errorf("status = %q, want completed", got)
+	}
+	events := pendingOutboxEvents(t, store)[len(orderIDs):]
+	if len(events) != 1 || events[0].EventType != model.EventOrderDelivered || events[0].AggregateID != orderID {
+		t.Errorf("events = %+v, want one %s for order %d", events, model.EventOrderDelivered, orderID)
+	}
+	if ev := <-stream; ev.OrderID != orderID || ev.ShippedStatus != "completed" {
+		t.Errorf("streamed event = %+v, want order %d completed", ev, orderID)
+	}
+
+	// shippingへの戻しはイベントにしない
+	if err := svc.UpdateOrderStatus(ctx, orderID, "shipping"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pendingOutboxEvents(t, store)); n != len(orderIDs)+1 {
+		t.Errorf("outbox events = %d, want %d", n, len(orderIDs)+1)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "password"
+
+func newTestStore(t *testing.T) (*repository.MemoryDB, *repository.Store) {
+	t.Helper()
+	db := repository.NewMemoryDB()
+	return db, repository.NewMemoryStore(db)
+}
+
+func createTestUser(t *testing.T, db *repository.MemoryDB, userName string) int {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db.AddUser(model.User{UserName: userName, PasswordHash: string(hash)}).UserID
+}
+
+func createTestProduct(t *testing.T, store *repository.Store, name string, value, weight int) int {
+	t.Helper()
+	productID, err := store.ProductRepo.Create(context.Background(), model.ProductInput{Name: name, Value: value, Weight: weight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return productID
+}
+
+func listTestOrders(t *testing.T, store *repository.Store, userID int) []model.Order {
+	t.Helper()
+	orders, _, err := store.OrderRepo.ListOrders(context.Background(), userID, model.ListRequest{Page: 1, PageSize: 100, SortField: "order_id", SortOrder: "asc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return orders
+}
+
+func pendingOutboxEvents(t *testing.T, store *repository.Store) []model.OutboxEvent {
+	t.Helper()
+	events, err := store.OutboxRepo.ClaimPending(context.Background(), time.Now(), 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// fnがエラーを返した場合、fn内の変更はすべて取り消される
+func TestExecTxRollback(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestStore(t)
+	userID := createTestUser(t, db, "user")
+	productID := createTestProduct(t, store, "商品", 100, 1)
+
+	errFail := errors.New("fail")
+	err := store.ExecTx(ctx, func(txStore *repository.Store) error {
+		if _, err := txStore.OrderRepo.CreateBulk(ctx, []model.Order{{UserID: userID, ProductID: productID}}); err != nil {
+			return err
+		}
+		if err := txStore.OutboxRepo.Add(ctx, []model.OutboxEvent{{EventID: "e1", EventType: model.EventOrderCreated, Payload: []byte(`{}`)}}); err != nil {
+			return err
+		}
+		if err := txStore.ProductRepo.SoftDelete(ctx, productID); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("ExecTx error = %v, want %v", err, errFail)
+	}
+
+	if orders := listTestOrders(t, store, userID); len(orders) != 0 {
+		t.Errorf("orders after rollback = %d, want 0", len(orders))
+	}
+	if events := pendingOutboxEvents(t, store); len(events) != 0 {
+		t.Errorf("outbox events after rollback = %d, want 0", len(events))
+	}
+	if n, err := store.ProductRepo.CountActive(ctx, []int{productID}); err != nil || n != 1 {
+		t.Errorf("active products after rollback = %d (err %v), want 1", n, err)
+	}
+
+	// 成功した場合はコミットされる
+	err = store.ExecTx(ctx, func(txStore *repository.Store) error {
+		_, err := txStore.OrderRepo.CreateBulk(ctx, []model.Order{{UserID: userID, ProductID: productID}})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orders := listTestOrders(t, store, userID); len(orders) != 1 {
+		t.Errorf("orders after commit = %d, want 1", len(orders))
+	}
+}
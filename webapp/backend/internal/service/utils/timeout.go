@@ -1,33 +1,72 @@
 package utils
 
 import (
+	"backend/internal/logging"
+	"backend/internal/metrics"
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"time"
+
+	"go.opentelemetry.io/otel"
 )
 
-var defaultTimeout = 2 * time.Second
+// 段階ごとのタイムアウト (リクエストごとにcontextで受け渡す)
+type stageTimeoutsKey struct{}
 
-// 終わらない処理などによる無限ループを防ぐため、タイムアウト付きで処理を実行する
-func WithTimeout(parent context.Context, fn func(ctx context.Context) error) error {
-	timeout := defaultTimeout
-	if dl, ok := parent.Deadline(); ok {
-		if rem := time.Until(dl); rem > 0 && rem < timeout {
-			timeout = rem
-		}
+// 段階ごとのタイムアウトをcontextに設定する
+// ルートのタイムアウトとあわせて、middleware.Timeoutがリクエストごとに設定する
+func WithStageTimeouts(ctx context.Context, timeouts map[string]time.Duration) context.Context {
+	if len(timeouts) == 0 {
+		return ctx
 	}
+	return context.WithValue(ctx, stageTimeoutsKey{}, timeouts)
+}
+
+// 期限切れで中断した段階
+// Errはcontext.DeadlineExceededを含むため、errors.Isで判定できる
+type TimeoutError struct {
+	Stage string
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out during %s: %v", e.Stage, e.Err)
+}
 
-	ctx, cancel := context.WithTimeout(parent, timeout)
-	defer cancel()
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
 
-	done := make(chan error, 1)
-	go func() { done <- fn(ctx) }()
+// fnを段階stageとして実行する
+// 段階のタイムアウトが設定されていれば、リクエストの期限より短い場合にそれを適用する
+// fnは同じgoroutineで実行するため、期限切れでfnが中断するまで戻らない (fnはctxを確認すること)
+// 期限切れの場合は、最も内側の段階を持つ*TimeoutErrorを返す
+func RunStage(ctx context.Context, stage string, fn func(ctx context.Context) error) error {
+	if timeouts, ok := ctx.Value(stageTimeoutsKey{}).(map[string]time.Duration); ok {
+		if d, ok := timeouts[stage]; ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+	}
+	ctx, span := otel.Tracer("service").Start(ctx, stage)
+	defer span.End()
 
-	select {
-	case err := <-done:
+	err := fn(ctx)
+	if err == nil {
+		return nil
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
 		return err
-	case <-ctx.Done():
-		log.Printf("処理がタイムアウトしました (timeout=%s)", timeout)
-		return ctx.Err()
 	}
+	// 期限切れ以外のエラーはそのまま返す (期限後に返った別のエラーをタイムアウトにすり替えない)
+	if errors.Is(err, context.DeadlineExceeded) {
+		logging.Warn(ctx, "operation timed out", "stage", stage, "error", err)
+		metrics.Timeout(stage)
+		span.RecordError(err)
+		return &TimeoutError{Stage: stage, Err: err}
+	}
+	return err
 }
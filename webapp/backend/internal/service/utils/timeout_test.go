@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRunStage(t *testing.T) {
+	ctx := WithStageTimeouts(context.Background(), map[string]time.Duration{"slow": time.Millisecond})
+
+	// 段階のタイムアウトで中断した場合は*TimeoutErrorになり、元のエラーも辿れる
+	err := RunStage(ctx, "slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return fmt.Errorf("query: %w", ctx.Err())
+	})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Stage != "slow" {
+		t.Fatalf("err = %v, want *TimeoutError for stage slow", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want to match context.DeadlineExceeded", err)
+	}
+	if errors.Unwrap(err) != timeoutErr.Err {
+		t.Errorf("Unwrap() = %v, want %v", errors.Unwrap(err), timeoutErr.Err)
+	}
+
+	// 内側の段階のエラーはそのまま返す
+	err = RunStage(ctx, "outer", func(ctx context.Context) error {
+		return RunStage(ctx, "slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	})
+	if !errors.As(err, &timeoutErr) || timeoutErr.Stage != "slow" {
+		t.Errorf("nested: err = %v, want *TimeoutError for stage slow", err)
+	}
+
+	// 期限切れ後でも、期限切れ以外のエラーはタイムアウトにしない
+	errOther := errors.New("other")
+	err = RunStage(ctx, "slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return errOther
+	})
+	if err != errOther {
+		t.Errorf("err = %v, want %v", err, errOther)
+	}
+}
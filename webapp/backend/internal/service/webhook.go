@@ -0,0 +1,164 @@
+package service
+
+import (
+	"backend/internal/logging"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/webhook"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrWebhookNotFound = newError(KindNotFound, "webhook_not_found", "webhook not found")
+
+const (
+	webhookURLMaxLength = 2048
+	// 再送待ちの一覧で返す件数の上限
+	webhookDeadLetterLimit = 100
+)
+
+// 購読できるイベントの種類
+var webhookEventTypes = []string{model.EventOrderCreated, model.EventOrderClaimed, model.EventOrderDelivered}
+
+type WebhookService struct {
+	store *repository.Store
+	// プライベートアドレスなど内部ネットワークへの登録を許可する
+	allowPrivateTargets bool
+}
+
+func NewWebhookService(store *repository.Store, allowPrivateTargets bool) *WebhookService {
+	return &WebhookService{store: store, allowPrivateTargets: allowPrivateTargets}
+}
+
+// Webhookを登録する
+// 署名用のSecretを生成し、このレスポンスでのみ返す
+func (s *WebhookService) CreateSubscription(ctx context.Context, input model.WebhookSubscriptionInput) (*model.WebhookSubscription, error) {
+	sub, err := validateWebhookInput(input, s.allowPrivateTargets)
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	sub.Secret = "whsec_" + hex.EncodeToString(secret)
+	sub.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	sub.ID, err = s.store.WebhookRepo.CreateSubscription(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	logging.Info(ctx, "created webhook", "webhook_id", sub.ID, "event_types", sub.EventTypes)
+	return sub, nil
+}
+
+// 登録の一覧 (Secretは返さない)
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	subs, err := s.store.WebhookRepo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 登録がない場合も空の配列を返す
+	if subs == nil {
+		subs = []model.WebhookSubscription{}
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+// 登録を削除する (未送信の配信と再送待ちも削除する)
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id int64) error {
+	if err := s.store.WebhookRepo.DeleteSubscription(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookNotFound
+		}
+		return err
+	}
+	logging.Info(ctx, "deleted webhook", "webhook_id", id)
+	return nil
+}
+
+// 再送待ちの配信を新しい順に取得する
+func (s *WebhookService) ListDeadLetters(ctx context.Context, id int64) ([]model.WebhookDeadLetter, error) {
+	if err := s.checkSubscription(ctx, id); err != nil {
+		return nil, err
+	}
+	deadLetters, err := s.store.WebhookRepo.ListDeadLetters(ctx, id, webhookDeadLetterLimit)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetters == nil {
+		deadLetters = []model.WebhookDeadLetter{}
+	}
+	return deadLetters, nil
+}
+
+// 再送待ちの配信を再送し、再送する件数を返す (idsが空の場合は登録のすべて)
+// 試行回数は0に戻り、再びmax_attempts回まで再試行する
+func (s *WebhookService) Replay(ctx context.Context, id int64, ids []int64) (int64, error) {
+	if err := s.checkSubscription(ctx, id); err != nil {
+		return 0, err
+	}
+	var n int64
+	err := s.store.ExecTx(ctx, func(txStore *repository.Store) error {
+		var err error
+		n, err = txStore.WebhookRepo.Replay(ctx, id, ids, time.Now())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	logging.Info(ctx, "replayed webhook dead letters", "webhook_id", id, "deliveries", n)
+	return n, nil
+}
+
+func (s *WebhookService) checkSubscription(ctx context.Context, id int64) error {
+	subs, err := s.store.WebhookRepo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(subs, func(sub model.WebhookSubscription) bool { return sub.ID == id }) {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// 登録の入力値を検証する (イベントの種類は重複を取り除く)
+func validateWebhookInput(input model.WebhookSubscriptionInput, allowPrivateTargets bool) (*model.WebhookSubscription, error) {
+	rawURL := strings.TrimSpace(input.URL)
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &ValidationError{Field: "url", Message: "must be an http or https URL"}
+	}
+	if len(rawURL) > webhookURLMaxLength {
+		return nil, &ValidationError{Field: "url", Message: fmt.Sprintf("must be at most %d characters", webhookURLMaxLength)}
+	}
+	if !allowPrivateTargets {
+		if err := webhook.CheckHost(u.Hostname()); err != nil {
+			return nil, &ValidationError{Field: "url", Message: "must not point to a private, loopback or link-local address"}
+		}
+	}
+	if len(input.EventTypes) == 0 {
+		return nil, &ValidationError{Field: "event_types", Message: "must not be empty"}
+	}
+	var eventTypes []string
+	for _, t := range input.EventTypes {
+		if !slices.Contains(webhookEventTypes, t) {
+			return nil, &ValidationError{Field: "event_types", Message: fmt.Sprintf("must be one of %s: %q", strings.Join(webhookEventTypes, ", "), t)}
+		}
+		if !slices.Contains(eventTypes, t) {
+			eventTypes = append(eventTypes, t)
+		}
+	}
+	return &model.WebhookSubscription{URL: rawURL, EventTypes: eventTypes}, nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateWebhookRejectsPrivateTargets(t *testing.T) {
+	ctx := context.Background()
+	_, store := newTestStore(t)
+	s := NewWebhookService(store, false)
+
+	for _, url := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/hook",
+		"http://[fd00:ec2::254]/hook",
+	} {
+		_, err := s.CreateSubscription(ctx, model.WebhookSubscriptionInput{URL: url, EventTypes: []string{model.EventOrderCreated}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "url" {
+			t.Errorf("CreateSubscription(%q) = %v, want a url validation error", url, err)
+		}
+	}
+
+	sub, err := s.CreateSubscription(ctx, model.WebhookSubscriptionInput{
+		URL: "https://example.com/hook", EventTypes: []string{model.EventOrderCreated, model.EventOrderCreated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.EventTypes) != 1 || sub.Secret == "" {
+		t.Errorf("CreateSubscription() = %+v", sub)
+	}
+
+	// ローカルでの動作確認用に許可できる
+	_, allowedStore := newTestStore(t)
+	allowed := NewWebhookService(allowedStore, true)
+	if _, err := allowed.CreateSubscription(ctx, model.WebhookSubscriptionInput{
+		URL: "http://localhost:8080/hook", EventTypes: []string{model.EventOrderCreated},
+	}); err != nil {
+		t.Errorf("CreateSubscription(localhost) with allowPrivateTargets = %v", err)
+	}
+}
+
+func TestReplayWebhookDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	_, store := newTestStore(t)
+	s := NewWebhookService(store, false)
+
+	sub, err := s.CreateSubscription(ctx, model.WebhookSubscriptionInput{URL: "https://example.com/hook", EventTypes: []string{model.EventOrderCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []model.OutboxEvent{
+		{EventID: "event-1", EventType: model.EventOrderCreated, Payload: []byte(`{}`)},
+		{EventID: "event-2", EventType: model.EventOrderCreated, Payload: []byte(`{}`)},
+	}
+	if _, err := store.WebhookRepo.Enqueue(ctx, events, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := store.WebhookRepo.ClaimDue(ctx, time.Now(), 10, time.Minute)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("ClaimDue() = %+v, %v", deliveries, err)
+	}
+	for _, dl := range deliveries {
+		if err := store.WebhookRepo.RetryDelivery(ctx, dl.ID, time.Now(), "status 500"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.WebhookRepo.DeadLetter(ctx, dl.ID, "status 500", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadLetters, err := s.ListDeadLetters(ctx, sub.ID)
+	if err != nil || len(deadLetters) != 2 {
+		t.Fatalf("ListDeadLetters() = %+v, %v", deadLetters, err)
+	}
+
+	// 指定した配信だけを再送する
+	n, err := s.Replay(ctx, sub.ID, []int64{deadLetters[0].ID})
+	if err != nil || n != 1 {
+		t.Fatalf("Replay() = %d, %v", n, err)
+	}
+	replayed, err := store.WebhookRepo.ClaimDue(ctx, time.Now(), 10, time.Minute)
+	if err != nil || len(replayed) != 1 {
+		t.Fatalf("ClaimDue() after replay = %+v, %v", replayed, err)
+	}
+	// 試行回数は0に戻る
+	if replayed[0].EventID != deadLetters[0].EventID || replayed[0].Attempts != 0 {
+		t.Errorf("replayed delivery = %+v", replayed[0])
+	}
+
+	// 省略した場合は残りすべてを再送する
+	if n, err := s.Replay(ctx, sub.ID, nil); err != nil || n != 1 {
+		t.Fatalf("Replay(all) = %d, %v", n, err)
+	}
+	if deadLetters, err := s.ListDeadLetters(ctx, sub.ID); err != nil || len(deadLetters) != 0 {
+		t.Errorf("ListDeadLetters() after replay = %+v, %v", deadLetters, err)
+	}
+
+	if _, err := s.Replay(ctx, sub.ID+1, nil); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Replay(unknown) = %v, want ErrWebhookNotFound", err)
+	}
+}
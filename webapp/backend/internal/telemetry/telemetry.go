@@ -1,109 +1,272 @@
-// internal/telemetry/telemetry.go
+// トレース・メトリクス・ログのOpenTelemetryプロバイダーを一箇所で初期化する
 package telemetry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"backend/internal/config"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
-	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-func enabled() bool {
-	if strings.EqualFold(os.Getenv("TRACE_ENABLED"), "false") {
-		return false
+// メトリクスをエクスポートする間隔
+const metricExportInterval = 15 * time.Second
+
+// WrapSQLDriverがDBのスパンを出すかどうか (Initで設定する)
+var tracingEnabled bool
+
+// 初期化したプロバイダー群。Shutdownで未送信のデータを送ってから停止する
+type Telemetry struct {
+	// cfg.Logsが有効な場合、ログをOTLP等に送るslogハンドラー
+	LogHandler slog.Handler
+
+	shutdowns []func(context.Context) error
+}
+
+// 無効な場合でもプロパゲーターは設定し、上流から受け取ったトレースコンテキストを引き継ぐ
+func Init(ctx context.Context, cfg config.TelemetryConfig) (*Telemetry, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	t := &Telemetry{}
+	if !cfg.Enabled {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return t, nil
 	}
-	if strings.EqualFold(os.Getenv("TRACE_ENABLED"), "true") {
-		return true
+
+	res, err := newResource(cfg)
+	if err != nil {
+		return nil, err
 	}
-	if os.Getenv("JAEGER_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
-		return true
+
+	var w io.Writer = os.Stdout
+	if strings.EqualFold(cfg.Exporter, "file") {
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open telemetry file: %w", err)
+		}
+		w = f
+		// プロバイダーの停止後に閉じるよう、最初に登録する (Shutdownは逆順に呼ぶ)
+		t.shutdowns = append(t.shutdowns, func(context.Context) error { return f.Close() })
 	}
-	return false
-}
 
-func samplerFromEnv() sdktrace.Sampler {
-	if r := os.Getenv("TRACE_SAMPLE_RATIO"); r != "" {
-		if v, err := strconv.ParseFloat(r, 64); err == nil {
-			return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(v))
+	if err := t.initTraces(ctx, cfg, res, w); err != nil {
+		t.Shutdown(ctx)
+		return nil, err
+	}
+	if cfg.Metrics {
+		if err := t.initMetrics(ctx, cfg, res, w); err != nil {
+			t.Shutdown(ctx)
+			return nil, err
 		}
 	}
-	switch strings.ToLower(os.Getenv("OTEL_TRACES_SAMPLER")) {
-	case "always_off":
-		return sdktrace.NeverSample()
-	case "always_on":
-		return sdktrace.AlwaysSample()
+	if cfg.Logs {
+		if err := t.initLogs(ctx, cfg, res, w); err != nil {
+			t.Shutdown(ctx)
+			return nil, err
+		}
 	}
-	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.01))
+	tracingEnabled = true
+	return t, nil
 }
 
-func resourceFromEnv() *resource.Resource {
-	svc := os.Getenv("SERVICE_NAME")
-	if svc == "" {
-		svc = "backend"
-	}
-	env := os.Getenv("ENV")
-	if env == "" {
-		env = os.Getenv("GO_ENV")
-		if env == "" {
-			env = "local"
+// 登録と逆順にプロバイダーを停止する
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	for i := len(t.shutdowns) - 1; i >= 0; i-- {
+		if err := t.shutdowns[i](ctx); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	r, _ := resource.Merge(
+	t.shutdowns = nil
+	return errors.Join(errs...)
+}
+
+func newResource(cfg config.TelemetryConfig) (*resource.Resource, error) {
+	return resource.Merge(
 		resource.Default(),
 		resource.NewWithAttributes(
 			semconv.SchemaURL,
-			semconv.ServiceName(svc),
-			attribute.String("deployment.environment", env),
+			semconv.ServiceName(cfg.ServiceName),
+			attribute.String("deployment.environment", cfg.Environment),
 		),
 	)
-	return r
 }
 
-func Init(ctx context.Context) (func(context.Context) error, error) {
-	if !enabled() {
-		otel.SetTracerProvider(trace.NewNoopTracerProvider())
-		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-			propagation.TraceContext{}, propagation.Baggage{},
-		))
-		return func(context.Context) error { return nil }, nil
-	}
-
+func (t *Telemetry) initTraces(ctx context.Context, cfg config.TelemetryConfig, res *resource.Resource, w io.Writer) error {
 	var (
 		exp sdktrace.SpanExporter
 		err error
 	)
-	if ep := os.Getenv("JAEGER_ENDPOINT"); ep != "" {
-		exp, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(ep)))
-	} else if ep := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); ep != "" {
-		exp, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(ep), otlptracehttp.WithInsecure())
+	switch exporterKind(cfg) {
+	case "grpc":
+		opts := []otlptracegrpc.Option{}
+		if isURL(cfg.Endpoint) {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err = otlptracegrpc.New(ctx, opts...)
+	case "http":
+		opts := []otlptracehttp.Option{}
+		if isURL(cfg.Endpoint) {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(ctx, opts...)
+	default:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(w))
 	}
-	if err != nil || exp == nil {
-		otel.SetTracerProvider(trace.NewNoopTracerProvider())
-		return func(context.Context) error { return nil }, nil
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
 	}
 
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(samplerFromEnv()),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
 		sdktrace.WithBatcher(exp,
 			sdktrace.WithMaxQueueSize(4096),
 			sdktrace.WithExportTimeout(5*time.Second),
 		),
-		sdktrace.WithResource(resourceFromEnv()),
+		sdktrace.WithResource(res),
 	)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{}, propagation.Baggage{},
-	))
-	return tp.Shutdown, nil
+	t.shutdowns = append(t.shutdowns, tp.Shutdown)
+	return nil
+}
+
+func (t *Telemetry) initMetrics(ctx context.Context, cfg config.TelemetryConfig, res *resource.Resource, w io.Writer) error {
+	var (
+		exp sdkmetric.Exporter
+		err error
+	)
+	switch exporterKind(cfg) {
+	case "grpc":
+		opts := []otlpmetricgrpc.Option{}
+		if isURL(cfg.Endpoint) {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		exp, err = otlpmetricgrpc.New(ctx, opts...)
+	case "http":
+		opts := []otlpmetrichttp.Option{}
+		if isURL(cfg.Endpoint) {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		exp, err = otlpmetrichttp.New(ctx, opts...)
+	default:
+		exp, err = stdoutmetric.New(stdoutmetric.WithWriter(w))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(metricExportInterval))),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	t.shutdowns = append(t.shutdowns, mp.Shutdown)
+	return nil
+}
+
+func (t *Telemetry) initLogs(ctx context.Context, cfg config.TelemetryConfig, res *resource.Resource, w io.Writer) error {
+	var (
+		exp sdklog.Exporter
+		err error
+	)
+	switch exporterKind(cfg) {
+	case "grpc":
+		opts := []otlploggrpc.Option{}
+		if isURL(cfg.Endpoint) {
+			opts = append(opts, otlploggrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlploggrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlploggrpc.WithInsecure())
+		}
+		exp, err = otlploggrpc.New(ctx, opts...)
+	case "http":
+		opts := []otlploghttp.Option{}
+		if isURL(cfg.Endpoint) {
+			opts = append(opts, otlploghttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlploghttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlploghttp.WithInsecure())
+		}
+		exp, err = otlploghttp.New(ctx, opts...)
+	default:
+		exp, err = stdoutlog.New(stdoutlog.WithWriter(w))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create log exporter: %w", err)
+	}
+
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+		sdklog.WithResource(res),
+	)
+	global.SetLoggerProvider(lp)
+	t.LogHandler = otelslog.NewHandler(cfg.ServiceName, otelslog.WithLoggerProvider(lp))
+	t.shutdowns = append(t.shutdowns, lp.Shutdown)
+	return nil
+}
+
+// grpc / http / stdout (fileはstdoutの出力先を変えたもの)
+func exporterKind(cfg config.TelemetryConfig) string {
+	if !strings.EqualFold(cfg.Exporter, "otlp") {
+		return "stdout"
+	}
+	if strings.HasPrefix(strings.ToLower(cfg.Protocol), "http") {
+		return "http"
+	}
+	return "grpc"
+}
+
+func isURL(endpoint string) bool {
+	return strings.Contains(endpoint, "://")
 }
@@ -0,0 +1,238 @@
+// 予約されたWebhookを登録先に署名付きで送信し、失敗した場合は間隔を空けて再送する
+package webhook
+
+import (
+	"backend/internal/metrics"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 送信時のヘッダー
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// 送信中に他のサーバーが同じ配信を取得しないよう、タイムアウトに加えて確保する時間
+const leaseMargin = 30 * time.Second
+
+type Config struct {
+	// 送信時刻になった配信を確認する間隔
+	PollInterval time.Duration
+	// 1回に取得して並行に送信する配信数
+	BatchSize int
+	// この回数失敗した配信は再送待ち(webhook_dead_letters)に移す
+	MaxAttempts int
+	// 再送の間隔 (失敗するたびに倍にし、BackoffMaxを上限とする)
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// 1回の送信のタイムアウト
+	Timeout time.Duration
+	// プライベートアドレスなど内部ネットワークへの送信を許可する (ローカルでの動作確認用)
+	AllowPrivateTargets bool
+}
+
+// "<Unixタイムスタンプ>.<ボディ>"のHMAC-SHA256 (16進数)
+// 受信側は同じ値を計算し、X-Webhook-Signatureの"sha256="以降と比較する
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 配信を定期的に取得して送信する
+// 取得した配信はleaseの間だけ他のサーバーから見えなくなり、送信の結果で削除・再送・再送待ちにする
+// 結果を記録する前に止まった場合はlease後に再送するため、送信は少なくとも1回となる
+type Dispatcher struct {
+	store  *repository.Store
+	client *http.Client
+	cfg    Config
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewDispatcher(store *repository.Store, cfg Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: newClient(cfg),
+		cfg:    cfg,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// 接続先のアドレスを検証し、リダイレクトに従わないクライアント
+// リダイレクトで内部ネットワークに誘導されないよう、3xxはそのまま失敗として扱う
+func newClient(cfg Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateTargets {
+		// プロキシを経由すると接続先を検証できないため使わない
+		transport.Proxy = nil
+		dialer := &net.Dialer{Timeout: cfg.Timeout, KeepAlive: 30 * time.Second, Control: checkDial}
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// バックグラウンドで送信を始める
+func (d *Dispatcher) Start() {
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			d.drain()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// 送信を止める (送信中の配信は完了を待つ)
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	close(d.stop)
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 送信時刻になった配信がなくなるまで送信する
+func (d *Dispatcher) drain() {
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+		n, err := d.dispatchBatch()
+		if err != nil {
+			slog.Warn("webhook dispatcher failed", "error", err)
+			return
+		}
+		if n < d.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// 1バッチを送信し、取得した件数を返す
+func (d *Dispatcher) dispatchBatch() (int, error) {
+	ctx := context.Background()
+	lease := d.cfg.Timeout + leaseMargin
+
+	var deliveries []model.WebhookDelivery
+	err := d.store.ExecTx(ctx, func(txStore *repository.Store) error {
+		var err error
+		deliveries, err = txStore.WebhookRepo.ClaimDue(ctx, time.Now(), d.cfg.BatchSize, lease)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.finish(ctx, delivery, d.send(ctx, delivery))
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// 署名を付けて送信する (2xx以外のレスポンスは失敗とする)
+func (d *Dispatcher) send(ctx context.Context, delivery model.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.EventID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(delivery.Secret, timestamp, delivery.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 送信の結果を記録する
+// 記録に失敗した配信はlease後に再送される
+func (d *Dispatcher) finish(ctx context.Context, delivery model.WebhookDelivery, sendErr error) {
+	var err error
+	var result string
+	switch attempts := delivery.Attempts + 1; {
+	case sendErr == nil:
+		result = "delivered"
+		err = d.store.WebhookRepo.DeleteDelivery(ctx, delivery.ID)
+	case attempts >= d.cfg.MaxAttempts:
+		result = "dead_letter"
+		err = d.store.ExecTx(ctx, func(txStore *repository.Store) error {
+			return txStore.WebhookRepo.DeadLetter(ctx, delivery.ID, sendErr.Error(), time.Now())
+		})
+		slog.Warn("webhook delivery moved to dead letters",
+			"subscription_id", delivery.SubscriptionID, "event_id", delivery.EventID, "attempts", attempts, "error", sendErr)
+	default:
+		result = "retry"
+		err = d.store.WebhookRepo.RetryDelivery(ctx, delivery.ID, time.Now().Add(d.backoff(attempts)), sendErr.Error())
+	}
+	metrics.WebhookDeliveries(result)
+	if err != nil {
+		slog.Warn("failed to record webhook delivery result",
+			"subscription_id", delivery.SubscriptionID, "event_id", delivery.EventID, "result", result, "error", err)
+	}
+}
+
+// attempts回失敗した後の再送までの間隔
+// 同時に失敗した配信が一斉に再送しないよう、最大で1/4の揺らぎを加える
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.BackoffMax
+	if shift := attempts - 1; shift < 32 {
+		if b := d.cfg.BackoffBase << shift; b > 0 && b < wait {
+			wait = b
+		}
+	}
+	return wait + rand.N(wait/4+1)
+}
@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestDispatcher(t *testing.T, cfg Config) (*Dispatcher, *repository.Store) {
+	t.Helper()
+	store := repository.NewMemoryStore(repository.NewMemoryDB())
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return NewDispatcher(store, cfg), store
+}
+
+// urlへの購読を登録し、OrderCreatedを1件予約する
+func enqueueTestDelivery(t *testing.T, store *repository.Store, url string) int64 {
+	t.Helper()
+	ctx := context.Background()
+	id, err := store.WebhookRepo.CreateSubscription(ctx, &model.WebhookSubscription{
+		URL: url, Secret: "whsec_test", EventTypes: []string{model.EventOrderCreated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.WebhookRepo.Enqueue(ctx, []model.OutboxEvent{{
+		EventID: "event-1", EventType: model.EventOrderCreated, AggregateID: 1, Payload: []byte(`{"order_id":1}`),
+	}}, time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("Enqueue() = %d, %v", n, err)
+	}
+	return id
+}
+
+func claimAll(t *testing.T, store *repository.Store, at time.Time) []model.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.WebhookRepo.ClaimDue(context.Background(), at, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func TestSign(t *testing.T) {
+	// python: hmac.new(b"whsec_test", b'1700000000.{"id":1}', hashlib.sha256).hexdigest()
+	const want = "2f441ba4b3b2d50d28a9ab9d9fd8880376ecd1eb5d0435401553f5d8d0a5dcf8"
+	if got := Sign("whsec_test", "1700000000", []byte(`{"id":1}`)); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+	if Sign("whsec_other", "1700000000", []byte(`{"id":1}`)) == want {
+		t.Error("Sign() does not depend on the secret")
+	}
+	if Sign("whsec_test", "1700000001", []byte(`{"id":1}`)) == want {
+		t.Error("Sign() does not depend on the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{cfg: Config{BackoffBase: 10 * time.Second, BackoffMax: time.Hour}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		// シフトで桁あふれしても上限を超えない
+		{40, time.Hour},
+		{64, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		for range 50 {
+			got := d.backoff(tt.attempts)
+			if got < tt.want || got > tt.want+tt.want/4 {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempts, got, tt.want, tt.want+tt.want/4)
+			}
+		}
+	}
+
+	// 揺らぎがある
+	seen := map[time.Duration]bool{}
+	for range 50 {
+		seen[d.backoff(1)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("backoff() has no jitter")
+	}
+}
+
+func TestDispatchDeliversSignedRequest(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, Config{MaxAttempts: 3, AllowPrivateTargets: true})
+	enqueueTestDelivery(t, store, srv.URL)
+	if n, err := d.dispatchBatch(); err != nil || n != 1 {
+		t.Fatalf("dispatchBatch() = %d, %v", n, err)
+	}
+
+	if got == nil {
+		t.Fatal("webhook was not sent")
+	}
+	timestamp := got.Header.Get(HeaderTimestamp)
+	if sig := got.Header.Get(HeaderSignature); sig != "sha256="+Sign("whsec_test", timestamp, body) {
+		t.Errorf("signature = %s", sig)
+	}
+	if got.Header.Get(HeaderID) != "event-1" || got.Header.Get(HeaderEvent) != model.EventOrderCreated {
+		t.Errorf("headers = %v", got.Header)
+	}
+	// 送信に成功した配信は削除される
+	if deliveries := claimAll(t, store, time.Now().Add(48*time.Hour)); len(deliveries) != 0 {
+		t.Errorf("deliveries after success = %+v", deliveries)
+	}
+}
+
+func TestFinishRetriesThenDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	d, store := newTestDispatcher(t, Config{
+		MaxAttempts: 2, BackoffBase: time.Minute, BackoffMax: time.Hour, AllowPrivateTargets: true,
+	})
+	subID := enqueueTestDelivery(t, store, srv.URL)
+
+	// 1回目の失敗は間隔を空けて再送する
+	if _, err := d.dispatchBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries := claimAll(t, store, time.Now()); len(deliveries) != 0 {
+		t.Fatalf("delivery is due right after a failure: %+v", deliveries)
+	}
+	deliveries := claimAll(t, store, time.Now().Add(2*time.Minute))
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 {
+		t.Fatalf("deliveries after first failure = %+v", deliveries)
+	}
+
+	// max_attempts回目の失敗は再送待ちに移す
+	d.finish(ctx, deliveries[0], errors.New("webhook responded with status 500"))
+	if deliveries := claimAll(t, store, time.Now().Add(48*time.Hour)); len(deliveries) != 0 {
+		t.Fatalf("deliveries after dead letter = %+v", deliveries)
+	}
+	deadLetters, err := store.WebhookRepo.ListDeadLetters(ctx, subID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 2 || deadLetters[0].LastError != "webhook responded with status 500" {
+		t.Fatalf("dead letters = %+v", deadLetters)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server received %d requests, want 1", calls.Load())
+	}
+}
+
+func TestSendRefusesPrivateTargets(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	d, _ := newTestDispatcher(t, Config{})
+	err := d.send(context.Background(), model.WebhookDelivery{URL: srv.URL, Body: []byte(`{}`)})
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("send() = %v, want ErrForbiddenTarget", err)
+	}
+	if calls.Load() != 0 {
+		t.Error("request reached a loopback server")
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	var redirected atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	d, _ := newTestDispatcher(t, Config{AllowPrivateTargets: true})
+	if err := d.send(context.Background(), model.WebhookDelivery{URL: srv.URL, Body: []byte(`{}`)}); err == nil {
+		t.Error("send() succeeded for a redirect")
+	}
+	if redirected.Load() != 0 {
+		t.Error("redirect was followed")
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	forbidden := []string{
+		"localhost", "LOCALHOST.", "api.localhost",
+		"127.0.0.1", "0.0.0.0", "10.0.0.1", "172.16.0.1", "192.168.1.1",
+		"169.254.169.254", "100.100.100.200",
+		"::1", "::", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1", "::ffff:10.0.0.1",
+	}
+	for _, host := range forbidden {
+		if err := CheckHost(host); !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("CheckHost(%q) = %v, want ErrForbiddenTarget", host, err)
+		}
+	}
+	// ホスト名は送信時に名前解決した結果で検証する
+	for _, host := range []string{"example.com", "93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"} {
+		if err := CheckHost(host); err != nil {
+			t.Errorf("CheckHost(%q) = %v", host, err)
+		}
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	if err := checkDial("tcp", "127.0.0.1:80", nil); !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("checkDial(loopback) = %v", err)
+	}
+	if err := checkDial("tcp", "[fe80::1]:443", nil); !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("checkDial(link-local) = %v", err)
+	}
+	if err := checkDial("tcp", "93.184.215.14:443", nil); err != nil {
+		t.Errorf("checkDial(public) = %v", err)
+	}
+	if err := CheckAddr(netip.Addr{}); err == nil {
+		t.Error("CheckAddr(invalid) succeeded")
+	}
+}
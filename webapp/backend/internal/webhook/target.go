@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+var ErrForbiddenTarget = errors.New("webhook target is a private or reserved address")
+
+// 内部ネットワークへのリクエスト(SSRF)を防ぐため、送信先として拒否するアドレス
+// ループバック・プライベート(RFC1918, fc00::/7)・リンクローカル(169.254.169.254などのメタデータを含む)など
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// 送信先として使えるアドレスか
+func CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() || addr.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, addr)
+	}
+	for _, p := range forbiddenPrefixes {
+		if p.Contains(addr) {
+			return fmt.Errorf("%w: %s", ErrForbiddenTarget, addr)
+		}
+	}
+	return nil
+}
+
+// 登録時に分かる範囲で送信先のホストを検証する (IPアドレスとlocalhost)
+// 名前解決の結果は変わりうるため、ホスト名は送信時の接続でも検証する
+func CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return CheckAddr(addr)
+	}
+	return nil
+}
+
+// 名前解決後の接続先アドレスを検証するnet.DialerのControl
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	return CheckAddr(addr)
+}
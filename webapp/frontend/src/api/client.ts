@@ -0,0 +1,9 @@
+import axios from "axios";
+
+// バックエンドのCSRF対策 (Double Submit Cookie) に合わせて、
+// ログイン時に発行されるXSRF-TOKEN CookieをX-XSRF-TOKENヘッダーで送り返す
+export const apiClient = axios.create({
+  xsrfCookieName: "XSRF-TOKEN",
+  xsrfHeaderName: "X-XSRF-TOKEN",
+  withXSRFToken: true,
+});
@@ -1,4 +1,4 @@
-import axios from "axios";
+import { apiClient } from "@/api/client";
 
 type User = {
   UserId: number;
@@ -9,7 +9,7 @@ export async function login(
   userName: string,
   password: string
 ): Promise<User | null> {
-  const { data: user } = await axios.post<User>("/api/login", {
+  const { data: user } = await apiClient.post<User>("/api/login", {
     user_name: userName,
     password: password,
   });
@@ -7,7 +7,7 @@ import {
   GridRenderCellParams,
   GridSortModel,
 } from "@mui/x-data-grid";
-import axios from "axios";
+import { apiClient } from "@/api/client";
 import {
   Box,
   Container,
@@ -68,7 +68,7 @@ export default function OrdersPage() {
       const sortF = model[0]?.field ?? "order_id";
       const sortO = model[0]?.sort ?? "desc";
       setIsLoading(true);
-      axios
+      apiClient
         .post("/api/v1/orders", {
           search: searchQuery,
           type: searchType,
@@ -7,7 +7,7 @@ import {
   GridRenderCellParams,
   GridSortModel,
 } from "@mui/x-data-grid";
-import axios from "axios";
+import { apiClient } from "@/api/client";
 import {
   Box,
   Container,
@@ -53,7 +53,7 @@ export default function ProductListPage() {
       setIsLoading(true);
       const sortF = model[0]?.field ?? "product_id";
       const sortO = model[0]?.sort ?? "asc";
-      axios
+      apiClient
         .post("/api/v1/product", {
           search: searchQuery,
           page: pageNum,
@@ -102,7 +102,7 @@ export default function ProductListPage() {
     }
 
     try {
-      await axios.post("/api/v1/product/post", {
+      await apiClient.post("/api/v1/product/post", {
         items: selected,
       });
       alert("注文が正常に送信されました。");
@@ -0,0 +1,4 @@
+-- 商品の論理削除用カラム
+-- ordersはproductsに対してON DELETE CASCADEのため、物理削除すると注文履歴が消えてしまう
+ALTER TABLE products
+  ADD COLUMN deleted_at DATETIME NULL DEFAULT NULL;
@@ -0,0 +1,10 @@
+-- 0_sample.sql で追加したインデックスを削除する
+ALTER TABLE products
+  DROP INDEX ft_products_name_desc;
+
+ALTER TABLE orders
+  DROP INDEX idx_orders_shipping;
+
+DROP INDEX idx_products_count ON products;
+
+DROP INDEX idx_products_name ON products;
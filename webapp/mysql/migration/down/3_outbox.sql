@@ -0,0 +1,2 @@
+-- 3_outbox.sql で追加したテーブルを削除する (未配信のイベントも削除される)
+DROP TABLE outbox_events;